@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/makhkets/wildberries-l0/internal/archiver"
+	"github.com/makhkets/wildberries-l0/internal/cache"
+	"github.com/makhkets/wildberries-l0/internal/config"
+	"github.com/makhkets/wildberries-l0/internal/db"
+	"github.com/makhkets/wildberries-l0/pkg/lib/logger/sl"
+	"github.com/makhkets/wildberries-l0/pkg/logging"
+)
+
+func main() {
+	logging.SetupLogger()
+	cfg := config.GetConfig()
+
+	once := flag.Bool("once", true, "run a single archiving pass and exit (false - run periodically until interrupted)")
+	flag.DurationVar(&cfg.Retention.ArchiveAfter, "archive-after", cfg.Retention.ArchiveAfter, "archive orders older than this age")
+	flag.Parse()
+
+	if cfg.Retention.ArchiveAfter <= 0 {
+		slog.Error("archive-after must be positive")
+		os.Exit(1)
+	}
+
+	if cfg.Retention.BatchSize < 1 {
+		slog.Error("RETENTION_BATCH_SIZE must be at least 1")
+		os.Exit(1)
+	}
+
+	if !*once && cfg.Retention.Interval <= 0 {
+		slog.Error("RETENTION_INTERVAL must be positive")
+		os.Exit(1)
+	}
+
+	cacheInstance := cache.MustLoad(cfg)
+	defer func() {
+		if err := cacheInstance.Close(); err != nil {
+			slog.Error("Failed to close cache", sl.Err(err))
+		}
+	}()
+
+	database := db.MustLoad(cfg)
+	defer func() {
+		if err := database.Close(); err != nil {
+			slog.Error("Failed to close database", sl.Err(err))
+		}
+	}()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	orderArchiver := archiver.NewArchiver(cfg, database, cacheInstance)
+
+	if !*once {
+		if err := orderArchiver.Start(ctx); err != nil {
+			slog.Error("Order archiver error", sl.Err(err))
+		}
+		return
+	}
+
+	archived, err := orderArchiver.RunOnce(ctx)
+	if err != nil {
+		slog.Error("Order archiving failed", "archived", archived, sl.Err(err))
+		return
+	}
+
+	slog.Info("Order archiving finished", "archived", archived)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/makhkets/wildberries-l0/pkg/lib/logger/sl"
 
 	"github.com/makhkets/wildberries-l0/internal/api"
+	"github.com/makhkets/wildberries-l0/internal/archiver"
 	"github.com/makhkets/wildberries-l0/internal/cache"
 	"github.com/makhkets/wildberries-l0/internal/config"
 	"github.com/makhkets/wildberries-l0/internal/db"
@@ -74,6 +75,14 @@ func main() {
 		}
 	}()
 
+	// Инициализация relay событий из outbox
+	outboxRelay := kafka.NewOutboxRelay(cfg, database)
+	defer func() {
+		if err = outboxRelay.Close(); err != nil {
+			slog.Error("Failed to close outbox relay", sl.Err(err))
+		}
+	}()
+
 	server := api.NewServer(cfg, services)
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -91,6 +100,29 @@ func main() {
 		}
 	}()
 
+	// Запуск outbox relay в отдельной горутине
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		slog.Info("Starting outbox relay...")
+		if err := outboxRelay.Start(ctx); err != nil {
+			slog.Error("Outbox relay error", sl.Err(err))
+		}
+	}()
+
+	// Запуск архивации старых заказов, если она включена
+	if cfg.Retention.Enabled {
+		orderArchiver := archiver.NewArchiver(cfg, database, cacheInstance)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := orderArchiver.Start(ctx); err != nil {
+				slog.Error("Order archiver error", sl.Err(err))
+			}
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mrand "math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+var (
+	firstNames = []string{"Ivan", "Anna", "Sergey", "Olga", "Dmitry", "Maria", "Alexey", "Elena", "Test"}
+	lastNames  = []string{"Ivanov", "Petrova", "Sidorov", "Smirnova", "Kuznetsov", "Popova", "Testov"}
+	cities     = []struct{ city, region, zip string }{
+		{"Moscow", "Moscow", "101000"},
+		{"Saint Petersburg", "Leningradskaya oblast", "190000"},
+		{"Kazan", "Tatarstan", "420000"},
+		{"Novosibirsk", "Novosibirskaya oblast", "630000"},
+		{"Kiryat Mozkin", "Kraiot", "2639809"},
+	}
+	streets    = []string{"Ploshad Mira", "Lenina", "Tverskaya", "Nevsky prospekt", "Baumana"}
+	currencies = []string{"RUB", "USD", "EUR"}
+	providers  = []string{"wbpay", "sbp", "card"}
+	banks      = []string{"alpha", "sber", "tinkoff", "vtb"}
+	services   = []string{"meest", "cdek", "wb-courier", "boxberry"}
+	locales    = []string{"en", "ru"}
+	products   = []struct{ name, brand string }{
+		{"Mascaras", "Vivienne Sabo"},
+		{"T-shirt", "Nike"},
+		{"Sneakers", "Adidas"},
+		{"Backpack", "Xiaomi"},
+		{"Headphones", "Sony"},
+		{"Lipstick", "Maybelline"},
+		{"Jeans", "Levi's"},
+	}
+	sizes = []string{"0", "S", "M", "L", "XL", "42"}
+)
+
+// generateOrder создает заказ со случайными, но согласованными данными:
+// total_price учитывает скидку, goods_total равен сумме total_price,
+// amount равен goods_total + delivery_cost + custom_fee
+func generateOrder(maxItems int) *model.Order {
+	uid := randomHex(8) + "test"
+	track := "WB" + strings.ToUpper(randomHex(6))
+	location := pick(cities)
+	name := pick(firstNames) + " " + pick(lastNames)
+
+	order := &model.Order{
+		OrderUID:          uid,
+		TrackNumber:       track,
+		Entry:             "WBIL",
+		Locale:            pick(locales),
+		InternalSignature: "",
+		CustomerID:        "customer-" + randomHex(3),
+		DeliveryService:   pick(services),
+		Shardkey:          fmt.Sprint(mrand.IntN(10)),
+		SmID:              mrand.IntN(100) + 1,
+		DateCreated:       time.Now().UTC().Add(-time.Duration(mrand.IntN(72)) * time.Hour).Truncate(time.Second),
+		OofShard:          fmt.Sprint(mrand.IntN(3)),
+		Delivery: &model.Delivery{
+			Name:    name,
+			Phone:   fmt.Sprintf("+7%010d", mrand.IntN(1e10)),
+			Zip:     location.zip,
+			City:    location.city,
+			Address: fmt.Sprintf("%s %d", pick(streets), mrand.IntN(200)+1),
+			Region:  location.region,
+			Email:   strings.ToLower(strings.ReplaceAll(name, " ", ".")) + "@example.com",
+		},
+	}
+
+	itemsCount := mrand.IntN(maxItems) + 1
+	var goodsTotal model.Amount
+	for i := 0; i < itemsCount; i++ {
+		product := pick(products)
+		price := model.Amount(mrand.IntN(5000) + 100)
+		sale := mrand.IntN(8) * 5
+		totalPrice := price * model.Amount(100-sale) / 100
+
+		order.Items = append(order.Items, model.Item{
+			ChrtID:      mrand.IntN(9_000_000) + 1_000_000,
+			TrackNumber: track,
+			Price:       price,
+			RID:         randomHex(10) + "test",
+			Name:        product.name,
+			Sale:        sale,
+			Size:        pick(sizes),
+			TotalPrice:  totalPrice,
+			NmID:        mrand.IntN(9_000_000) + 1_000_000,
+			Brand:       product.brand,
+			Status:      int(model.ItemStatusActive),
+		})
+		goodsTotal += totalPrice
+	}
+
+	deliveryCost := model.Amount(mrand.IntN(20) * 100)
+	order.Payment = &model.Payment{
+		Transaction:  uid,
+		RequestID:    "",
+		Currency:     pick(currencies),
+		Provider:     pick(providers),
+		Amount:       goodsTotal + deliveryCost,
+		PaymentDt:    order.DateCreated.Unix(),
+		Bank:         pick(banks),
+		DeliveryCost: deliveryCost,
+		GoodsTotal:   goodsTotal,
+		CustomFee:    0,
+	}
+
+	return order
+}
+
+// malformedPayload портит корректный payload одним из способов, которые должен отклонить consumer
+func malformedPayload(valid []byte) ([]byte, string) {
+	text := string(valid)
+
+	switch mrand.IntN(5) {
+	case 0:
+		return valid[:len(valid)/2], "truncated JSON"
+	case 1:
+		return []byte(strings.Replace(text, `"amount":`, `"amount":"`, 1)), "invalid JSON"
+	case 2:
+		return []byte(strings.Replace(text, `"sm_id":`, `"sm_id":"x","sm_id_old":`, 1)), "wrong type and unknown field"
+	case 3:
+		return []byte(strings.Replace(text, `"delivery":`, `"delivery_removed":`, 1)), "missing delivery"
+	default:
+		return []byte(strings.Replace(text, `"items":[`, `"items":[],"items_removed":[`, 1)), "empty items"
+	}
+}
+
+// randomHex возвращает случайную hex-строку из n байт
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// pick возвращает случайный элемент среза
+func pick[T any](values []T) T {
+	return values[mrand.IntN(len(values))]
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	mrand "math/rand/v2"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/makhkets/wildberries-l0/internal/config"
+	"github.com/makhkets/wildberries-l0/internal/kafka"
+	"github.com/makhkets/wildberries-l0/internal/model"
+	"github.com/makhkets/wildberries-l0/pkg/lib/logger/sl"
+	"github.com/makhkets/wildberries-l0/pkg/logging"
+)
+
+type options struct {
+	topic          string
+	rate           float64
+	count          int
+	duplicateRatio float64
+	malformedRatio float64
+	maxItems       int
+}
+
+func main() {
+	logging.SetupLogger()
+	cfg := config.GetConfig()
+
+	opts := parseFlags(cfg)
+	if err := validateOptions(opts); err != nil {
+		fmt.Println(err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	producer := kafka.NewTopicProducer(cfg.Kafka.Brokers, opts.topic)
+	defer func() {
+		if err := producer.Close(); err != nil {
+			slog.Error("Failed to close Kafka producer", sl.Err(err))
+		}
+	}()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	slog.Info("Starting order producer",
+		"topic", opts.topic,
+		"brokers", cfg.Kafka.Brokers,
+		"rate", opts.rate,
+		"count", opts.count,
+		"duplicate_ratio", opts.duplicateRatio,
+		"malformed_ratio", opts.malformedRatio)
+
+	stats := run(ctx, producer, opts)
+
+	slog.Info("Order producer finished",
+		"sent", stats.sent,
+		"orders", stats.orders,
+		"duplicates", stats.duplicates,
+		"malformed", stats.malformed,
+		"failed", stats.failed)
+}
+
+func parseFlags(cfg *config.Config) options {
+	var opts options
+
+	flag.StringVar(&opts.topic, "topic", cfg.Kafka.Topic, "Kafka topic to publish orders to")
+	flag.Float64Var(&opts.rate, "rate", 10, "messages per second (0 - as fast as possible)")
+	flag.IntVar(&opts.count, "count", 100, "total number of messages to publish (0 - until interrupted)")
+	flag.Float64Var(&opts.duplicateRatio, "duplicates", 0, "ratio of messages that repeat an already published order (0..1)")
+	flag.Float64Var(&opts.malformedRatio, "malformed", 0, "ratio of malformed messages (0..1)")
+	flag.IntVar(&opts.maxItems, "max-items", 5, "maximum number of items in a generated order")
+	flag.Parse()
+
+	return opts
+}
+
+func validateOptions(opts options) error {
+	if opts.rate < 0 {
+		return fmt.Errorf("rate cannot be negative")
+	}
+	if opts.count < 0 {
+		return fmt.Errorf("count cannot be negative")
+	}
+	if opts.duplicateRatio < 0 || opts.malformedRatio < 0 || opts.duplicateRatio+opts.malformedRatio > 1 {
+		return fmt.Errorf("duplicates and malformed must be in [0, 1] and their sum cannot exceed 1")
+	}
+	if opts.maxItems < 1 {
+		return fmt.Errorf("max-items must be at least 1")
+	}
+	return nil
+}
+
+type runStats struct {
+	sent, orders, duplicates, malformed, failed int
+}
+
+// publishedOrder опубликованный заказ, который может быть отправлен повторно
+type publishedOrder struct {
+	order   *model.Order
+	eventID string
+}
+
+// run публикует сообщения с заданной частотой, пока не будет отправлено count сообщений
+// или не будет отменен контекст
+func run(ctx context.Context, producer kafka.Producer, opts options) runStats {
+	var stats runStats
+	var published []publishedOrder
+
+	var ticker *time.Ticker
+	if opts.rate > 0 {
+		ticker = time.NewTicker(time.Duration(float64(time.Second) / opts.rate))
+		defer ticker.Stop()
+	}
+
+	for opts.count == 0 || stats.sent+stats.failed < opts.count {
+		if ticker != nil {
+			select {
+			case <-ctx.Done():
+				return stats
+			case <-ticker.C:
+			}
+		} else if ctx.Err() != nil {
+			return stats
+		}
+
+		message := publishedOrder{order: generateOrder(opts.maxItems), eventID: randomHex(16)}
+		kind := "order"
+
+		var err error
+		roll := mrand.Float64()
+		switch {
+		case roll < opts.duplicateRatio && len(published) > 0:
+			// Повторяем ранее опубликованный заказ без изменений, с тем же идентификатором события
+			message = published[mrand.IntN(len(published))]
+			kind = "duplicate"
+			err = producer.PublishOrder(ctx, message.order, kafka.EventTypeOrderUpserted, message.eventID)
+		case roll >= opts.duplicateRatio && roll < opts.duplicateRatio+opts.malformedRatio:
+			// Некорректный payload с заголовками конверта текущей версии схемы
+			var value []byte
+			if value, err = kafka.EncodeOrder(message.order); err != nil {
+				slog.Error("Failed to encode order", "uid", message.order.OrderUID, sl.Err(err))
+				stats.failed++
+				continue
+			}
+			value, kind = malformedPayload(value)
+			err = producer.Publish(ctx, []byte(message.order.OrderUID), value,
+				kafka.EnvelopeHeaders(kafka.EventTypeOrderUpserted, message.eventID)...)
+		default:
+			published = append(published, message)
+			err = producer.PublishOrder(ctx, message.order, kafka.EventTypeOrderUpserted, message.eventID)
+		}
+
+		if err != nil {
+			slog.Error("Failed to publish message", "kind", kind, sl.Err(err))
+			stats.failed++
+			continue
+		}
+
+		stats.sent++
+		switch kind {
+		case "order":
+			stats.orders++
+		case "duplicate":
+			stats.duplicates++
+		default:
+			stats.malformed++
+		}
+
+		slog.Debug("Message published", "key", message.order.OrderUID, "kind", kind)
+	}
+
+	return stats
+}
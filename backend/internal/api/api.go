@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/makhkets/wildberries-l0/internal/metrics"
 	"github.com/makhkets/wildberries-l0/internal/service"
 )
 
@@ -25,13 +26,18 @@ func (h *Handler) InitRoutes() *gin.Engine {
 	router := gin.New()
 
 	// Middleware
+	router.Use(RequestIDMiddleware())
 	router.Use(LoggingMiddleware())
+	router.Use(MetricsMiddleware())
 	router.Use(CORSMiddleware())
 	router.Use(gin.Recovery())
 
 	// Health check
 	router.GET("/health", h.HealthCheck)
 
+	// Метрики в формате Prometheus
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
 	// API v1 группа
 	v1 := router.Group("/api/v1")
 	{
@@ -39,9 +45,23 @@ func (h *Handler) InitRoutes() *gin.Engine {
 		// Orders routes
 		orders := v1.Group("/order")
 		{
-			orders.POST("", h.CreateOrder)       // POST /api/v1/orders
-			orders.GET("/:uid", h.GetOrderByUID) // GET /api/v1/orders/{uid}
+			orders.POST("", h.CreateOrder)                 // POST /api/v1/orders
+			orders.GET("/:uid", h.GetOrderByUID)           // GET /api/v1/orders/{uid}
+			orders.GET("/:uid/history", h.GetOrderHistory) // GET /api/v1/order/{uid}/history
+			orders.PUT("/:uid", h.ReplaceOrder)            // PUT /api/v1/order/{uid}
+			orders.PATCH("/:uid", h.PatchOrder)            // PATCH /api/v1/order/{uid}
+			orders.DELETE("/:uid", h.DeleteOrder)          // DELETE /api/v1/order/{uid}
+			orders.POST("/:uid/status", h.ChangeStatus)    // POST /api/v1/order/{uid}/status
+
+			// Поиск по вторичным ключам
+			orders.GET("/by-track/:track", h.GetOrderByTrackNumber)    // GET /api/v1/order/by-track/{track}
+			orders.GET("/by-transaction/:tx", h.GetOrderByTransaction) // GET /api/v1/order/by-transaction/{tx}
+			orders.GET("/by-rid/:rid", h.GetOrderByRID)                // GET /api/v1/order/by-rid/{rid}
 		}
+
+		// Список заказов с фильтрами и пагинацией
+		v1.GET("/orders", h.ListOrders)          // GET /api/v1/orders
+		v1.GET("/orders/search", h.SearchOrders) // GET /api/v1/orders/search?q=
 	}
 
 	return router
@@ -1,7 +1,11 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"log/slog"
@@ -9,6 +13,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	errors2 "github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/metrics"
 	"github.com/makhkets/wildberries-l0/internal/model"
 )
 
@@ -43,7 +48,159 @@ func (h *Handler) GetOrderByUID(c *gin.Context) {
 		"client_ip", c.ClientIP())
 }
 
+// GetOrderByTrackNumber GET /order/by-track/:track
+func (h *Handler) GetOrderByTrackNumber(c *gin.Context) {
+	order, err := h.services.GetOrderByTrackNumber(c.Request.Context(), c.Param("track"))
+	h.respondOrder(c, order, err)
+}
+
+// GetOrderByTransaction GET /order/by-transaction/:tx
+func (h *Handler) GetOrderByTransaction(c *gin.Context) {
+	order, err := h.services.GetOrderByTransaction(c.Request.Context(), c.Param("tx"))
+	h.respondOrder(c, order, err)
+}
+
+// GetOrderByRID GET /order/by-rid/:rid
+func (h *Handler) GetOrderByRID(c *gin.Context) {
+	order, err := h.services.GetOrderByRID(c.Request.Context(), c.Param("rid"))
+	h.respondOrder(c, order, err)
+}
+
+// respondOrder отправляет найденный заказ или ошибку поиска
+func (h *Handler) respondOrder(c *gin.Context, order *model.Order, err error) {
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Data: order,
+	})
+}
+
+// ListOrders GET /orders
+func (h *Handler) ListOrders(c *gin.Context) {
+	filter := model.OrderFilter{
+		CustomerID:      c.Query("customer_id"),
+		TrackNumber:     c.Query("track_number"),
+		DeliveryService: c.Query("delivery_service"),
+		Currency:        c.Query("currency"),
+		Provider:        c.Query("provider"),
+		Brand:           c.Query("brand"),
+	}
+
+	var err error
+	if filter.NmID, err = queryInt(c, "nm_id"); err != nil {
+		h.handleError(c, err)
+		return
+	}
+	if filter.Limit, err = queryInt(c, "limit"); err != nil {
+		h.handleError(c, err)
+		return
+	}
+	if filter.DateFrom, err = queryTime(c, "date_from"); err != nil {
+		h.handleError(c, err)
+		return
+	}
+	if filter.DateTo, err = queryTime(c, "date_to"); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	page, err := h.services.ListOrders(c.Request.Context(), filter, c.Query("cursor"))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Data: page,
+	})
+}
+
+// SearchOrders GET /orders/search
+func (h *Handler) SearchOrders(c *gin.Context) {
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	offset := 0
+	if value := c.Query("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			h.handleError(c, errors2.NewValidationError("offset", "must be a non-negative integer"))
+			return
+		}
+	}
+
+	page, err := h.services.SearchOrders(c.Request.Context(), c.Query("q"), limit, offset)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Data: page,
+	})
+}
+
+// queryInt читает необязательный положительный целочисленный параметр запроса (0, если не задан)
+func queryInt(c *gin.Context, name string) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, errors2.NewValidationError(name, "must be a positive integer")
+	}
+	return n, nil
+}
+
+// queryTime читает необязательный параметр запроса в формате RFC 3339 или YYYY-MM-DD.
+// date_created хранится в UTC без часового пояса, поэтому время приводится к UTC:
+// иначе смещение из запроса было бы отброшено при сравнении
+func queryTime(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			t = t.UTC()
+			return &t, nil
+		}
+	}
+	return nil, errors2.NewValidationError(name, "must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+}
+
+// GetOrderHistory GET /order/:uid/history
+func (h *Handler) GetOrderHistory(c *gin.Context) {
+	uid := c.Param("uid")
+
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	history, err := h.services.GetOrderHistory(c.Request.Context(), uid, limit)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Data: history,
+	})
+}
+
 // CreateOrder POST /orders
+// Возвращает 409 Conflict, если заказ с таким UID существует или был удален:
+// UID удаленного заказа остается занятым, пока заказ не будет архивирован
 func (h *Handler) CreateOrder(c *gin.Context) {
 	// Парсим JSON из запроса
 	var order model.Order
@@ -52,6 +209,7 @@ func (h *Handler) CreateOrder(c *gin.Context) {
 		h.handleError(c, errors2.NewValidationError("request_body", "invalid JSON format: "+err.Error()))
 		return
 	}
+	order.RequestID = c.GetString(requestIDKey)
 
 	err := h.services.CreateOrder(c.Request.Context(), &order)
 	if err != nil {
@@ -71,6 +229,133 @@ func (h *Handler) CreateOrder(c *gin.Context) {
 		"client_ip", c.ClientIP())
 }
 
+// ReplaceOrder PUT /order/:uid
+func (h *Handler) ReplaceOrder(c *gin.Context) {
+	uid := c.Param("uid")
+
+	var order model.Order
+	if err := c.ShouldBindJSON(&order); err != nil {
+		slog.Warn("Failed to decode request body", "error", err)
+		h.handleError(c, errors2.NewValidationError("request_body", "invalid JSON format: "+err.Error()))
+		return
+	}
+
+	if order.OrderUID == "" {
+		order.OrderUID = uid
+	}
+	if order.OrderUID != uid {
+		h.handleError(c, errors2.NewValidationError("order_uid", "must match the order UID in the path"))
+		return
+	}
+	order.RequestID = c.GetString(requestIDKey)
+
+	if err := h.services.ReplaceOrder(c.Request.Context(), &order); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Data:    order,
+		Message: "Order replaced successfully",
+	})
+}
+
+// maxPatchBodySize максимальный размер тела PATCH запроса
+const maxPatchBodySize = 1 << 20
+
+// PatchOrder PATCH /order/:uid (JSON Merge Patch, RFC 7396)
+func (h *Handler) PatchOrder(c *gin.Context) {
+	uid := c.Param("uid")
+
+	contentType := c.ContentType()
+	if contentType != "application/merge-patch+json" && contentType != "application/json" {
+		h.handleError(c, errors2.NewValidationError("Content-Type", "must be application/merge-patch+json"))
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPatchBodySize))
+	if err != nil {
+		h.handleError(c, errors2.NewValidationError("request_body", "failed to read request body"))
+		return
+	}
+
+	order, err := h.services.PatchOrder(c.Request.Context(), uid, patch, c.GetString(requestIDKey))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Data:    order,
+		Message: "Order patched successfully",
+	})
+}
+
+// DeleteOrder DELETE /order/:uid
+// UID удаленного заказа нельзя использовать для нового заказа до его архивации
+func (h *Handler) DeleteOrder(c *gin.Context) {
+	uid := c.Param("uid")
+
+	if err := h.services.DeleteOrder(c.Request.Context(), uid, c.GetString(requestIDKey)); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+
+	slog.Info("Order deleted via API",
+		"uid", uid,
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+		"client_ip", c.ClientIP())
+}
+
+// StatusRequest тело запроса изменения статуса; поля задаются названиями статусов
+type StatusRequest struct {
+	Status        string `json:"status"`
+	PaymentStatus string `json:"payment_status"`
+}
+
+// ChangeStatus POST /order/:uid/status
+func (h *Handler) ChangeStatus(c *gin.Context) {
+	var request StatusRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		h.handleError(c, errors2.NewValidationError("request_body", "invalid JSON format: "+err.Error()))
+		return
+	}
+
+	change := model.StatusChange{RequestID: c.GetString(requestIDKey)}
+
+	if request.Status != "" {
+		status, ok := model.ParseOrderStatus(request.Status)
+		if !ok {
+			h.handleError(c, errors2.NewValidationError("status", "unknown order status"))
+			return
+		}
+		change.OrderStatus = &status
+	}
+
+	if request.PaymentStatus != "" {
+		status, ok := model.ParsePaymentStatus(request.PaymentStatus)
+		if !ok {
+			h.handleError(c, errors2.NewValidationError("payment_status", "unknown payment status"))
+			return
+		}
+		change.PaymentStatus = &status
+	}
+
+	order, err := h.services.ChangeStatus(c.Request.Context(), c.Param("uid"), change)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Data:    order,
+		Message: "Order status changed successfully",
+	})
+}
+
 // handleError обрабатывает ошибки и возвращает соответствующий HTTP ответ
 func (h *Handler) handleError(c *gin.Context, err error) {
 	// Получаем структурированную ошибку
@@ -158,6 +443,26 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
+// requestIDKey ключ идентификатора запроса в контексте gin
+const requestIDKey = "request_id"
+
+// RequestIDMiddleware берет идентификатор запроса из заголовка X-Request-ID
+// или генерирует новый и возвращает его в ответе
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader("X-Request-ID")
+		if requestID == "" || len(requestID) > 255 {
+			b := make([]byte, 16)
+			_, _ = rand.Read(b)
+			requestID = hex.EncodeToString(b)
+		}
+
+		c.Set(requestIDKey, requestID)
+		c.Header("X-Request-ID", requestID)
+		c.Next()
+	}
+}
+
 // LoggingMiddleware логирует все входящие запросы
 func LoggingMiddleware() gin.HandlerFunc {
 	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
@@ -170,3 +475,21 @@ func LoggingMiddleware() gin.HandlerFunc {
 		return ""
 	})
 }
+
+// MetricsMiddleware собирает количество и длительность HTTP запросов по маршруту и статусу
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		// Используем шаблон маршрута, чтобы не плодить метки на каждый uid
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
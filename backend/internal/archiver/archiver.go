@@ -0,0 +1,82 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/makhkets/wildberries-l0/internal/cache"
+	"github.com/makhkets/wildberries-l0/internal/config"
+	"github.com/makhkets/wildberries-l0/internal/db"
+	"github.com/makhkets/wildberries-l0/pkg/lib/logger/sl"
+)
+
+// Archiver переносит старые и давно удаленные заказы в архивную таблицу
+// и удаляет их из кэша
+type Archiver struct {
+	repo   db.Repo
+	cache  cache.Repo
+	config *config.Config
+}
+
+// NewArchiver создает задачу архивации с параметрами из конфигурации
+func NewArchiver(cfg *config.Config, repo db.Repo, cache cache.Repo) *Archiver {
+	return &Archiver{
+		repo:   repo,
+		cache:  cache,
+		config: cfg,
+	}
+}
+
+// Start запускает архивацию сразу и затем с интервалом из конфигурации до отмены контекста
+func (a *Archiver) Start(ctx context.Context) error {
+	slog.Info("Starting order archiver",
+		"archive_after", a.config.Retention.ArchiveAfter,
+		"interval", a.config.Retention.Interval)
+
+	ticker := time.NewTicker(a.config.Retention.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := a.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Order archiving failed", sl.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopping order archiver")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce архивирует все подходящие заказы пачками и возвращает их количество
+func (a *Archiver) RunOnce(ctx context.Context) (int, error) {
+	total := 0
+
+	for ctx.Err() == nil {
+		uids, err := a.repo.ArchiveOrders(ctx, a.config.Retention.ArchiveAfter, a.config.Retention.BatchSize)
+		if err != nil {
+			return total, fmt.Errorf("failed to archive orders: %w", err)
+		}
+
+		for _, uid := range uids {
+			if err = a.cache.DeleteOrder(ctx, uid); err != nil {
+				slog.Warn("Failed to purge archived order from cache", "uid", uid, sl.Err(err))
+			}
+		}
+
+		total += len(uids)
+		if len(uids) < a.config.Retention.BatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		slog.Info("Orders archived", "count", total)
+	}
+
+	return total, ctx.Err()
+}
@@ -2,8 +2,11 @@ package cache
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -12,9 +15,30 @@ import (
 
 type Cache struct {
 	client *redis.Client
+
+	// maxOrders максимальное количество заказов в кэше
+	maxOrders int
+	// evictionPolicy политика вытеснения заказов (см. config.Eviction*)
+	evictionPolicy string
+	// lfuDecayPeriod период полураспада числа обращений для политики lfu
+	lfuDecayPeriod time.Duration
+
+	// Время жизни записей заказов (см. config.Redis)
+	orderTTL             time.Duration
+	ttlJitter            float64
+	staleWhileRevalidate bool
+	softTTL              time.Duration
+
+	// instanceID идентификатор экземпляра сервиса в сообщениях инвалидации
+	instanceID string
+
+	// Попадания и промахи Redis для статистики кэша
+	hits   atomic.Int64
+	misses atomic.Int64
 }
 
-// MustLoad создает новое подключение к Redis
+// MustLoad создает новое подключение к Redis. Скрипты кэша обращаются к ключам вытесняемых
+// заказов, не объявленным заранее, поэтому поддерживается только одиночный Redis, а не Redis Cluster
 func MustLoad(cfg *config.Config) Repo {
 	rdb := redis.NewClient(&redis.Options{
 		Addr:         fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port),
@@ -52,5 +76,37 @@ func MustLoad(cfg *config.Config) Repo {
 
 	slog.Info("Successfully connected to Redis")
 
-	return &Cache{client: rdb}
+	c := &Cache{
+		client:         rdb,
+		maxOrders:      cfg.Redis.MaxOrders,
+		evictionPolicy: cfg.Redis.EvictionPolicy,
+		lfuDecayPeriod: cfg.Redis.LFUDecayPeriod,
+
+		orderTTL:             cfg.Redis.OrderTTL,
+		ttlJitter:            cfg.Redis.TTLJitter,
+		staleWhileRevalidate: cfg.Redis.StaleWhileRevalidate,
+		softTTL:              cfg.Redis.SoftTTL,
+
+		instanceID: newInstanceID(),
+	}
+
+	if !cfg.Redis.L1Enabled {
+		return c
+	}
+
+	layered, err := newLayeredCache(c, cfg)
+	if err != nil {
+		slog.Error("Failed to subscribe to cache invalidation", "error", err)
+		panic(err)
+	}
+
+	slog.Info("In-process order cache enabled", "max_orders", cfg.Redis.L1MaxOrders, "ttl", cfg.Redis.L1TTL)
+	return layered
+}
+
+// newInstanceID случайный идентификатор экземпляра сервиса
+func newInstanceID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
 }
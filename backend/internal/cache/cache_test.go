@@ -0,0 +1,279 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/makhkets/wildberries-l0/internal/config"
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// newTestCache кэш поверх miniredis с заданным максимумом заказов
+func newTestCache(tb testing.TB, maxOrders int, policy string) (*Cache, *miniredis.Miniredis) {
+	tb.Helper()
+
+	server := miniredis.RunT(tb)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	tb.Cleanup(func() { _ = client.Close() })
+
+	return &Cache{
+		client:         client,
+		maxOrders:      maxOrders,
+		evictionPolicy: policy,
+		instanceID:     "test-instance",
+	}, server
+}
+
+// testOrder заказ типичного размера для записи в кэш
+func testOrder(uid string) *model.Order {
+	return &model.Order{
+		OrderUID:    uid,
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Locale:      "en",
+		CustomerID:  "test",
+		DateCreated: time.Now().UTC(),
+		Delivery: &model.Delivery{
+			Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com",
+		},
+		Payment: &model.Payment{
+			Transaction: "b563feb7b2b84b6test", Currency: "USD", Provider: "wbpay", Amount: 1817,
+			PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317,
+		},
+		Items: []model.Item{{
+			ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, RID: "ab4219087a764ae0btest",
+			Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202,
+		}},
+	}
+}
+
+// fillCache заполняет кэш заказами напрямую, минуя скрипт, чтобы не тратить время бенчмарка
+func fillCache(tb testing.TB, c *Cache, size int) {
+	tb.Helper()
+
+	ctx := context.Background()
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i := 0; i < size; i++ {
+			uid := fmt.Sprintf("fill-%d", i)
+			pipe.Set(ctx, orderCacheKey(uid), `{"order":{}}`, 0)
+			pipe.ZAdd(ctx, evictionIndexKey, &redis.Z{Score: float64(i), Member: uid})
+		}
+		return nil
+	})
+	if err != nil {
+		tb.Fatalf("fill cache: %v", err)
+	}
+}
+
+// roundTripCounter считает обращения к Redis: пайплайн или транзакция - одно обращение
+type roundTripCounter struct {
+	roundTrips atomic.Int64
+}
+
+func (c *roundTripCounter) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	c.roundTrips.Add(1)
+	return ctx, nil
+}
+
+func (c *roundTripCounter) AfterProcess(context.Context, redis.Cmder) error {
+	return nil
+}
+
+func (c *roundTripCounter) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	c.roundTrips.Add(1)
+	return ctx, nil
+}
+
+func (c *roundTripCounter) AfterProcessPipeline(context.Context, []redis.Cmder) error {
+	return nil
+}
+
+// BenchmarkSetOrders измеряет запись в заполненный кэш на нескольких размерах.
+// Каждая запись вытесняет заказ, и число обращений к Redis на запись не должно расти с размером кэша
+func BenchmarkSetOrders(b *testing.B) {
+	for _, size := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			ctx := context.Background()
+			c, _ := newTestCache(b, size, config.EvictionLRU)
+			fillCache(b, c, size)
+
+			// Загружаем скрипт заранее, иначе первая запись потратит лишнее обращение на NOSCRIPT
+			if err := setOrderScript.Load(ctx, c.client).Err(); err != nil {
+				b.Fatalf("load script: %v", err)
+			}
+
+			counter := &roundTripCounter{}
+			c.client.AddHook(counter)
+			order := testOrder("")
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				order.OrderUID = fmt.Sprintf("bench-%d", i)
+				if c.SetOrders(ctx, []*model.Order{order}) != 1 {
+					b.Fatalf("order %s was not cached", order.OrderUID)
+				}
+			}
+			b.StopTimer()
+
+			perWrite := float64(counter.roundTrips.Load()) / float64(b.N)
+			b.ReportMetric(perWrite, "roundtrips/op")
+			if perWrite != 1 {
+				b.Fatalf("expected 1 round trip per write at cache size %d, got %.2f", size, perWrite)
+			}
+
+			if cached, err := c.CountOrders(ctx); err != nil || cached != int64(size) {
+				b.Fatalf("expected cache to stay at %d orders, got %d (%v)", size, cached, err)
+			}
+		})
+	}
+}
+
+func TestCountOrdersSkipsExpiredOrders(t *testing.T) {
+	const ttl = 20 * time.Millisecond
+
+	ctx := context.Background()
+	c, server := newTestCache(t, 2, config.EvictionLRU)
+	c.orderTTL = ttl
+
+	if added := c.SetOrders(ctx, []*model.Order{testOrder("order-a"), testOrder("order-b")}); added != 2 {
+		t.Fatalf("expected 2 orders cached, got %d", added)
+	}
+	if cached, err := c.CountOrders(ctx); err != nil || cached != 2 {
+		t.Fatalf("expected 2 cached orders, got %d (%v)", cached, err)
+	}
+
+	// Истекают и ключи в Redis, и моменты истечения в индексе (по часам сервиса)
+	time.Sleep(2 * ttl)
+	server.FastForward(2 * ttl)
+
+	cached, err := c.CountOrders(ctx)
+	if err != nil || cached != 0 {
+		t.Fatalf("expired orders must not be counted, got %d (%v)", cached, err)
+	}
+	for _, key := range []string{evictionIndexKey, expiryIndexKey} {
+		if members, _ := server.ZMembers(key); len(members) != 0 {
+			t.Fatalf("expected %s to be purged, got %v", key, members)
+		}
+	}
+
+	// Истекшие заказы не занимают место: новые сохраняются без вытеснения друг друга
+	c.orderTTL = 0
+	c.SetOrders(ctx, []*model.Order{testOrder("order-c"), testOrder("order-d")})
+	for _, uid := range []string{"order-c", "order-d"} {
+		if !server.Exists(orderCacheKey(uid)) {
+			t.Fatalf("order %s must not be evicted", uid)
+		}
+	}
+	if members, _ := server.ZMembers(expiryIndexKey); len(members) != 0 {
+		t.Fatalf("orders without TTL must not be in the expiry index, got %v", members)
+	}
+}
+
+func TestSetOrdersSkipsOlderVersion(t *testing.T) {
+	const uid = "order-versioned"
+
+	ctx := context.Background()
+	c, _ := newTestCache(t, 10, config.EvictionLRU)
+
+	versioned := func(version int) *model.Order {
+		order := testOrder(uid)
+		order.Version = version
+		return order
+	}
+
+	for _, tc := range []struct {
+		version int
+		added   int
+		cached  int
+	}{
+		{version: 2, added: 1, cached: 2},
+		// Фоновое обновление, загруженное до изменения заказа, не откатывает кэш
+		{version: 1, added: 0, cached: 2},
+		{version: 2, added: 1, cached: 2},
+		{version: 3, added: 1, cached: 3},
+	} {
+		if added := c.SetOrders(ctx, []*model.Order{versioned(tc.version)}); added != tc.added {
+			t.Fatalf("version %d: expected %d orders added, got %d", tc.version, tc.added, added)
+		}
+		entry := c.GetOrderEntry(ctx, uid)
+		if entry == nil || entry.Order.Version != tc.cached {
+			t.Fatalf("version %d: expected cached version %d, got %+v", tc.version, tc.cached, entry)
+		}
+	}
+}
+
+func TestLFUCountsReadsWithAging(t *testing.T) {
+	const period = 100 * time.Millisecond
+
+	ctx := context.Background()
+	c, server := newTestCache(t, 10, config.EvictionLFU)
+	c.lfuDecayPeriod = period
+
+	score := func(uid string) float64 {
+		t.Helper()
+		value, err := server.ZScore(evictionIndexKey, uid)
+		if err != nil {
+			t.Fatalf("score of %s: %v", uid, err)
+		}
+		return value
+	}
+
+	c.SetOrders(ctx, []*model.Order{testOrder("order-read"), testOrder("order-written")})
+	c.GetOrderEntry(ctx, "order-read")
+	c.GetOrderEntry(ctx, "order-read")
+
+	// Перезапись (в том числе фоновое обновление) не считается обращением
+	c.SetOrders(ctx, []*model.Order{testOrder("order-written")})
+
+	if read, written := score("order-read"), score("order-written"); read != 3 || written != 1 {
+		t.Fatalf("expected scores 3 and 1, got %v and %v", read, written)
+	}
+
+	// Через два периода полураспада счетчики уменьшаются не меньше чем вчетверо
+	time.Sleep(2 * period)
+	c.GetOrderEntry(ctx, "order-read")
+
+	if written := score("order-written"); written > 0.25 || written <= 0 {
+		t.Fatalf("expected unread order score to decay below 0.25, got %v", written)
+	}
+	if read := score("order-read"); read > 1.75 || read <= 1 {
+		t.Fatalf("expected read order score to decay and count the new read, got %v", read)
+	}
+}
+
+func TestEvictionInvalidatesLocalCache(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCache(t, 1, config.EvictionFIFO)
+
+	layered, err := newLayeredCache(c, &config.Config{Redis: config.Redis{L1MaxOrders: 10, L1TTL: time.Minute}})
+	if err != nil {
+		t.Fatalf("subscribe to invalidations: %v", err)
+	}
+	defer layered.Close()
+
+	// Заказ, вытесненный записью этого же экземпляра, тоже сбрасывается из L1
+	layered.SetOrders(ctx, []*model.Order{testOrder("order-old")})
+	layered.SetOrders(ctx, []*model.Order{testOrder("order-new")})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, cached := layered.local.get("order-old"); !cached {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("evicted order must be dropped from L1")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, cached := layered.local.get("order-new"); !cached {
+		t.Fatal("saved order must stay in L1")
+	}
+}
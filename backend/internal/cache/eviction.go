@@ -0,0 +1,232 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// evictionIndexKey sorted set order_uid закэшированных заказов. Score задает порядок вытеснения
+// (вытесняются заказы с наименьшим score) и зависит от политики:
+// lru - время последнего обращения, lfu - число чтений с затуханием (см. ageFrequencies),
+// fifo - время добавления в кэш.
+// Префикс не совпадает с order:*, чтобы индекс не учитывался как заказ
+const evictionIndexKey = "orders:eviction"
+
+// expiryIndexKey sorted set order_uid заказов с TTL, score - момент истечения записи (unix, мкс).
+// Redis удаляет истекшие ключи сам, а из индекса вытеснения их убирает purgeExpired
+// перед подсчетом и вытеснением, иначе истекшие заказы занимали бы место в кэше
+const expiryIndexKey = "orders:expiry"
+
+// lfuAgingKey момент последнего затухания счетчиков обращений политики lfu (в единицах now)
+const lfuAgingKey = "orders:lfu:aged"
+
+// orderKeyPrefix префикс ключей заказов в кэше
+const orderKeyPrefix = "order:"
+
+// orderCacheKey ключ заказа в кэше
+func orderCacheKey(uid string) string {
+	return orderKeyPrefix + uid
+}
+
+// purgeExpired Lua-функция скриптов: убирает из индекса вытеснения (index) и индекса истечения (expiry)
+// заказы, TTL которых истек к моменту now, и возвращает их количество
+const purgeExpired = `
+local function purgeExpired(index, expiry, now)
+	local expired = redis.call('ZRANGEBYSCORE', expiry, '-inf', now)
+	for _, uid in ipairs(expired) do
+		redis.call('ZREM', index, uid)
+	end
+	redis.call('ZREMRANGEBYSCORE', expiry, '-inf', now)
+	return #expired
+end
+`
+
+// ageFrequencies Lua-функция скриптов: не чаще раза в период полураспада (period) умножает счетчики
+// обращений политики lfu в индексе на 2^(-прошедшее время/period). Момент последнего затухания
+// хранится в ключе aged; now и period передаются строками, чтобы не терять точность
+const ageFrequencies = `
+local function ageFrequencies(index, aged, now, period)
+	local last = tonumber(redis.call('GET', aged))
+	if not last then
+		redis.call('SET', aged, now)
+		return
+	end
+
+	local elapsed = tonumber(now) - last
+	if elapsed >= tonumber(period) then
+		redis.call('ZUNIONSTORE', index, 1, index, 'WEIGHTS', 0.5 ^ (elapsed / tonumber(period)))
+		redis.call('SET', aged, now)
+	end
+end
+`
+
+// getOrderScript читает заказ и отмечает обращение к нему в индексе вытеснения.
+// Если заказ уже удален из кэша, убирает его из индексов. В индекс попадают только заказы,
+// которые в нем уже есть, чтобы не вернуть туда запись, убранную вместе с ее моментом истечения.
+// Для lfu счетчики обращений затухают, поэтому заказы, популярные в прошлом, не остаются в кэше навсегда.
+// KEYS[1] - ключ заказа, KEYS[2] - индекс вытеснения, KEYS[3] - индекс истечения,
+// KEYS[4] - момент затухания lfu; ARGV[1] - order_uid, ARGV[2] - политика, ARGV[3] - текущее время,
+// ARGV[4] - период полураспада lfu
+var getOrderScript = redis.NewScript(ageFrequencies + `
+local value = redis.call('GET', KEYS[1])
+if not value then
+	redis.call('ZREM', KEYS[2], ARGV[1])
+	redis.call('ZREM', KEYS[3], ARGV[1])
+	return false
+end
+
+if ARGV[2] == 'lru' then
+	redis.call('ZADD', KEYS[2], 'XX', ARGV[3], ARGV[1])
+elseif ARGV[2] == 'lfu' and redis.call('ZSCORE', KEYS[2], ARGV[1]) then
+	ageFrequencies(KEYS[2], KEYS[4], ARGV[3], ARGV[4])
+	redis.call('ZINCRBY', KEYS[2], 1, ARGV[1])
+end
+
+return value
+`)
+
+// setOrderScript сохраняет заказ, обновляет индексы вытеснения и истечения, убирает из них истекшие заказы
+// и, если кэш переполнен, вытесняет заказы с наименьшим score (кроме только что сохраненного).
+// Для lfu запись не считается обращением: новый заказ получает счетчик 1, перезапись счетчик не меняет.
+// Запись не перезаписывает более новую версию заказа (например, фоновое обновление, загруженное
+// из базы до изменения заказа): в этом случае скрипт ничего не меняет и возвращает -1.
+// Иначе возвращает число вытесненных заказов.
+// Ключи вытесняемых заказов не передаются в KEYS: какие заказы будут вытеснены, известно только
+// внутри скрипта. Поэтому кэш требует одиночного Redis (или primary с репликами): в Redis Cluster
+// эти ключи могут оказаться в других слотах, и скрипт завершится ошибкой.
+// KEYS[1] - ключ заказа, KEYS[2] - индекс вытеснения, KEYS[3] - индекс истечения;
+// ARGV[1] - order_uid, ARGV[2] - заказ, ARGV[3] - политика, ARGV[4] - текущее время,
+// ARGV[5] - максимум заказов, ARGV[6] - префикс ключей заказов,
+// ARGV[7] - время жизни заказа в миллисекундах (0 - без истечения), ARGV[8] - момент истечения заказа,
+// ARGV[9] - канал инвалидации, ARGV[10] - сообщение инвалидации, ARGV[11] - версия заказа,
+// ARGV[12] - отправитель сообщений о вытеснении (для каждого вытесненного заказа публикуется инвалидация)
+var setOrderScript = redis.NewScript(purgeExpired + `
+local current = redis.call('GET', KEYS[1])
+if current then
+	local ok, stored = pcall(cjson.decode, current)
+	if ok and type(stored) == 'table' and type(stored.order) == 'table'
+		and tonumber(stored.order.version) and tonumber(stored.order.version) > tonumber(ARGV[11]) then
+		return -1
+	end
+end
+
+if tonumber(ARGV[7]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[7])
+	redis.call('ZADD', KEYS[3], ARGV[8], ARGV[1])
+else
+	redis.call('SET', KEYS[1], ARGV[2])
+	redis.call('ZREM', KEYS[3], ARGV[1])
+end
+redis.call('PUBLISH', ARGV[9], ARGV[10])
+
+if ARGV[3] == 'lfu' then
+	redis.call('ZADD', KEYS[2], 'NX', 1, ARGV[1])
+elseif ARGV[3] == 'fifo' then
+	redis.call('ZADD', KEYS[2], 'NX', ARGV[4], ARGV[1])
+else
+	redis.call('ZADD', KEYS[2], ARGV[4], ARGV[1])
+end
+
+purgeExpired(KEYS[2], KEYS[3], ARGV[4])
+
+local overflow = redis.call('ZCARD', KEYS[2]) - tonumber(ARGV[5])
+if overflow <= 0 then
+	return 0
+end
+
+local evicted = 0
+for _, uid in ipairs(redis.call('ZRANGE', KEYS[2], 0, overflow)) do
+	if evicted == overflow then
+		break
+	end
+	if uid ~= ARGV[1] then
+		redis.call('DEL', ARGV[6] .. uid)
+		redis.call('ZREM', KEYS[2], uid)
+		redis.call('ZREM', KEYS[3], uid)
+		redis.call('PUBLISH', ARGV[9], ARGV[12] .. ' ' .. uid)
+		evicted = evicted + 1
+	end
+end
+
+return evicted
+`)
+
+// countOrdersScript убирает из индексов истекшие заказы и возвращает количество заказов в кэше.
+// KEYS[1] - индекс вытеснения, KEYS[2] - индекс истечения; ARGV[1] - текущее время
+var countOrdersScript = redis.NewScript(purgeExpired + `
+purgeExpired(KEYS[1], KEYS[2], ARGV[1])
+return redis.call('ZCARD', KEYS[1])
+`)
+
+// now текущее время для score индекса вытеснения (в микросекундах, чтобы различать частые обращения)
+func now() int64 {
+	return time.Now().UnixMicro()
+}
+
+// expiresAt момент истечения записи с TTL ttl в единицах now. Момент считается на стороне сервиса:
+// передавать его скрипту строкой надежнее, чем вычислять в Lua, где большие числа теряют точность
+func expiresAt(ttl time.Duration) int64 {
+	return time.Now().Add(ttl).UnixMicro()
+}
+
+// DeleteOrder удаляет заказ из кэша вместе с записью в индексе вытеснения
+// и сообщает об удалении кэшам процессов других экземпляров
+func (c *Cache) DeleteOrder(ctx context.Context, uid string) error {
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, orderCacheKey(uid))
+		pipe.ZRem(ctx, evictionIndexKey, uid)
+		pipe.ZRem(ctx, expiryIndexKey, uid)
+		pipe.Publish(ctx, invalidationChannel, c.invalidationMessage(uid))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete order %s from cache: %w", uid, err)
+	}
+	return nil
+}
+
+// RebuildIndex добавляет в индекс вытеснения заказы, которые есть в кэше, но отсутствуют в индексе
+// (например, сохраненные до появления индекса), чтобы счетчик заказов и вытеснение их учитывали.
+// Такие заказы получают минимальный score и вытесняются первыми, а заказы с TTL попадают и в индекс истечения.
+// Обходит ключи через SCAN, поэтому вызывается только при запуске.
+// Возвращает количество добавленных в индекс заказов
+func (c *Cache) RebuildIndex(ctx context.Context) (int, error) {
+	added := 0
+
+	iter := c.client.Scan(ctx, 0, orderKeyPrefix+"*", scanBatchSize).Iterator()
+	for iter.Next(ctx) {
+		uid := strings.TrimPrefix(iter.Val(), orderKeyPrefix)
+
+		ttl, err := c.client.PTTL(ctx, iter.Val()).Result()
+		if err != nil {
+			return added, fmt.Errorf("failed to get TTL of cached order %s: %w", uid, err)
+		}
+
+		n, err := c.client.ZAddNX(ctx, evictionIndexKey, &redis.Z{Score: 0, Member: uid}).Result()
+		if err != nil {
+			return added, fmt.Errorf("failed to index cached order %s: %w", uid, err)
+		}
+		added += int(n)
+
+		if ttl > 0 {
+			expiry := &redis.Z{Score: float64(expiresAt(ttl)), Member: uid}
+			if err = c.client.ZAddNX(ctx, expiryIndexKey, expiry).Err(); err != nil {
+				return added, fmt.Errorf("failed to index expiry of cached order %s: %w", uid, err)
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return added, fmt.Errorf("failed to scan cached orders: %w", err)
+	}
+
+	return added, nil
+}
+
+// invalidationMessage сообщение инвалидации заказа для кэшей процессов других экземпляров
+func (c *Cache) invalidationMessage(uid string) string {
+	return c.instanceID + " " + uid
+}
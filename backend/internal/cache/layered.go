@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/makhkets/wildberries-l0/internal/config"
+	"github.com/makhkets/wildberries-l0/internal/metrics"
+	"github.com/makhkets/wildberries-l0/internal/model"
+	"github.com/makhkets/wildberries-l0/pkg/lib/logger/sl"
+)
+
+// Уровни кэша заказов
+const (
+	tierL1    = "l1"
+	tierRedis = "redis"
+)
+
+// invalidationChannel канал Redis pub/sub, в который каждый экземпляр сервиса публикует
+// order_uid сохраненных, удаленных и вытесненных заказов, чтобы остальные сбросили их из кэша процесса.
+// Сообщение имеет вид "<идентификатор экземпляра> <order_uid>"
+const invalidationChannel = "orders:invalidate"
+
+// evictionSender отправитель сообщений о вытеснении вместо идентификатора экземпляра:
+// вытесненный заказ сбрасывают из L1 все экземпляры, включая тот, чья запись его вытеснила
+const evictionSender = "evicted"
+
+// LayeredCache двухуровневый кэш заказов: кэш в памяти процесса (L1) перед Redis.
+// Записи L1 сбрасываются по сообщениям инвалидации от других экземпляров; если сообщение
+// потеряно (например, при переподключении к Redis), устаревание ограничено TTL записи L1.
+// Обращения, обслуженные L1, не обновляют порядок вытеснения в Redis
+type LayeredCache struct {
+	*Cache
+
+	local  *localCache
+	pubsub *redis.PubSub
+	done   chan struct{}
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// newLayeredCache подписывается на инвалидацию и создает кэш процесса перед Redis
+func newLayeredCache(c *Cache, cfg *config.Config) (*LayeredCache, error) {
+	ctx := context.Background()
+
+	pubsub := c.client.Subscribe(ctx, invalidationChannel)
+	// Дожидаемся подтверждения подписки, чтобы не пропустить инвалидации после запуска
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, err
+	}
+
+	layered := &LayeredCache{
+		Cache:  c,
+		local:  newLocalCache(cfg.Redis.L1MaxOrders, cfg.Redis.L1TTL),
+		pubsub: pubsub,
+		done:   make(chan struct{}),
+	}
+	go layered.listenInvalidations()
+
+	return layered, nil
+}
+
+// listenInvalidations сбрасывает из L1 заказы, измененные другими экземплярами, и вытесненные из Redis
+func (c *LayeredCache) listenInvalidations() {
+	defer close(c.done)
+
+	for message := range c.pubsub.Channel() {
+		instanceID, uid, ok := strings.Cut(message.Payload, " ")
+		if !ok || instanceID == c.instanceID {
+			continue
+		}
+
+		c.local.delete(uid)
+		metrics.CacheInvalidations.Inc()
+	}
+}
+
+// Close отписывается от инвалидации и закрывает подключение к Redis
+func (c *LayeredCache) Close() error {
+	if err := c.pubsub.Close(); err != nil {
+		slog.Warn("failed to close cache invalidation subscription", sl.Err(err))
+	}
+	<-c.done
+
+	return c.Cache.Close()
+}
+
+// GetOrder получает заказ из L1 или Redis (в том числе устаревший по мягкому TTL)
+func (c *LayeredCache) GetOrder(ctx context.Context, uid string) *model.Order {
+	entry := c.GetOrderEntry(ctx, uid)
+	if entry == nil {
+		return nil
+	}
+	return entry.Order
+}
+
+// GetOrderEntry получает заказ из L1, а при промахе - из Redis с сохранением в L1
+func (c *LayeredCache) GetOrderEntry(ctx context.Context, uid string) *CachedOrder {
+	if entry, ok := c.local.get(uid); ok {
+		c.hits.Add(1)
+		metrics.CacheLookups.WithLabelValues(tierL1, "hit").Inc()
+		return &CachedOrder{Order: entry.Order, Stale: entry.stale()}
+	}
+
+	c.misses.Add(1)
+	metrics.CacheLookups.WithLabelValues(tierL1, "miss").Inc()
+
+	entry := c.Cache.getOrderEntry(ctx, uid)
+	if entry == nil {
+		return nil
+	}
+
+	c.local.set(uid, *entry)
+	return &CachedOrder{Order: entry.Order, Stale: entry.stale()}
+}
+
+// SetOrders сохраняет заказы в Redis и L1; остальные экземпляры получают инвалидацию
+func (c *LayeredCache) SetOrders(ctx context.Context, orders []*model.Order) int {
+	successAdded := 0
+
+	for _, order := range orders {
+		entry, err := c.setOrder(ctx, order)
+		if err != nil {
+			// Старая запись L1 не должна пережить неудачное обновление,
+			// а при более новой версии в Redis L1 подтянет ее при следующем чтении
+			c.local.delete(order.OrderUID)
+			if errors.Is(err, errStaleOrder) {
+				slog.Debug("cached order is newer, skipping", slog.String("uid", order.OrderUID))
+				continue
+			}
+			slog.Error("failed to set order in cache", slog.String("uid", order.OrderUID), sl.Err(err))
+			continue
+		}
+
+		c.local.set(order.OrderUID, *entry)
+		successAdded++
+	}
+
+	return successAdded
+}
+
+// DeleteOrder удаляет заказ из L1 и Redis
+func (c *LayeredCache) DeleteOrder(ctx context.Context, uid string) error {
+	c.local.delete(uid)
+	return c.Cache.DeleteOrder(ctx, uid)
+}
+
+// GetCacheStats возвращает статистику Redis и L1
+func (c *LayeredCache) GetCacheStats(ctx context.Context) (map[string]interface{}, error) {
+	stats, err := c.Cache.GetCacheStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats["l1_orders"] = c.local.len()
+	stats["l1_hit_ratio"] = hitRatio(c.hits.Load(), c.misses.Load())
+
+	return stats, nil
+}
+
+// hitRatio доля попаданий среди обращений (0, если обращений не было)
+func hitRatio(hits, misses int64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// localShards количество шардов кэша процесса: каждый шард под своей блокировкой,
+// поэтому параллельные запросы к разным заказам почти не конкурируют
+const localShards = 16
+
+// localCache ограниченный по размеру и времени жизни LRU-кэш заказов в памяти процесса
+type localCache struct {
+	shards [localShards]*localShard
+	ttl    time.Duration
+}
+
+// localShard часть кэша процесса; list хранит записи от последней использованной к самой старой
+type localShard struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+// localEntry запись кэша процесса
+type localEntry struct {
+	uid       string
+	entry     cachedOrder
+	expiresAt time.Time
+}
+
+// newLocalCache создает кэш процесса на maxOrders заказов (с округлением вверх до числа шардов)
+func newLocalCache(maxOrders int, ttl time.Duration) *localCache {
+	capacity := (maxOrders + localShards - 1) / localShards
+
+	c := &localCache{ttl: ttl}
+	for i := range c.shards {
+		c.shards[i] = &localShard{
+			capacity: capacity,
+			entries:  make(map[string]*list.Element, capacity),
+			order:    list.New(),
+		}
+	}
+	return c
+}
+
+// shard возвращает шард заказа
+func (c *localCache) shard(uid string) *localShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(uid))
+	return c.shards[h.Sum32()%localShards]
+}
+
+// get возвращает копию записи заказа, если она есть и не истекла
+func (c *localCache) get(uid string) (cachedOrder, bool) {
+	s := c.shard(uid)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[uid]
+	if !ok {
+		return cachedOrder{}, false
+	}
+
+	item := element.Value.(*localEntry)
+	if time.Now().After(item.expiresAt) {
+		s.remove(element)
+		return cachedOrder{}, false
+	}
+
+	s.order.MoveToFront(element)
+
+	entry := item.entry
+	entry.Order = cloneOrder(entry.Order)
+	return entry, true
+}
+
+// set сохраняет копию записи заказа, вытесняя давно не использованные записи шарда
+func (c *localCache) set(uid string, entry cachedOrder) {
+	entry.Order = cloneOrder(entry.Order)
+	item := &localEntry{uid: uid, entry: entry, expiresAt: time.Now().Add(c.ttl)}
+
+	s := c.shard(uid)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[uid]; ok {
+		element.Value = item
+		s.order.MoveToFront(element)
+		return
+	}
+
+	s.entries[uid] = s.order.PushFront(item)
+	for s.order.Len() > s.capacity {
+		s.remove(s.order.Back())
+	}
+}
+
+// delete удаляет заказ из кэша процесса
+func (c *localCache) delete(uid string) {
+	s := c.shard(uid)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[uid]; ok {
+		s.remove(element)
+	}
+}
+
+// len возвращает количество записей (включая истекшие, но еще не удаленные)
+func (c *localCache) len() int {
+	total := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		total += s.order.Len()
+		s.mu.Unlock()
+	}
+	return total
+}
+
+// remove удаляет запись из шарда; вызывается под блокировкой шарда
+func (s *localShard) remove(element *list.Element) {
+	s.order.Remove(element)
+	delete(s.entries, element.Value.(*localEntry).uid)
+}
+
+// cloneOrder копирует заказ вместе со связанными данными, чтобы изменения заказа,
+// полученного из кэша процесса, не затрагивали сохраненную запись
+func cloneOrder(order *model.Order) *model.Order {
+	if order == nil {
+		return nil
+	}
+
+	clone := *order
+	if order.Delivery != nil {
+		delivery := *order.Delivery
+		clone.Delivery = &delivery
+	}
+	if order.Payment != nil {
+		payment := *order.Payment
+		clone.Payment = &payment
+	}
+	if order.Items != nil {
+		clone.Items = append([]model.Item(nil), order.Items...)
+	}
+	if order.Source != nil {
+		source := *order.Source
+		clone.Source = &source
+	}
+	return &clone
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/makhkets/wildberries-l0/internal/metrics"
 	"github.com/makhkets/wildberries-l0/internal/model"
 	"github.com/makhkets/wildberries-l0/pkg/lib/logger/sl"
 )
@@ -23,7 +24,13 @@ type Repo interface {
 	Exists(ctx context.Context, key string) (bool, error)
 
 	GetOrder(context context.Context, uid string) *model.Order
+	GetOrderEntry(ctx context.Context, uid string) *CachedOrder
 	SetOrders(context context.Context, orders []*model.Order) int
+	DeleteOrder(ctx context.Context, uid string) error
+	CountOrders(ctx context.Context) (int64, error)
+	RebuildIndex(ctx context.Context) (int, error)
+	GetOrderUIDByLookup(ctx context.Context, key model.LookupKey, value string) (string, bool)
+	SetOrderLookup(ctx context.Context, key model.LookupKey, value, uid string) error
 	GetCacheStats(ctx context.Context) (map[string]interface{}, error)
 
 	GetAllKeys(ctx context.Context, pattern string) ([]string, error)
@@ -66,45 +73,132 @@ func (c *Cache) Health() error {
 	return c.client.Ping(ctx).Err()
 }
 
-// GetOrder получает заказ из кэша
+// GetOrder получает заказ из кэша (в том числе устаревший по мягкому TTL)
 func (c *Cache) GetOrder(context context.Context, uid string) *model.Order {
-	val, err := c.client.Get(context, fmt.Sprintf("order:%s", uid)).Result()
+	entry := c.GetOrderEntry(context, uid)
+	if entry == nil {
+		return nil
+	}
+	return entry.Order
+}
+
+// GetOrderEntry получает заказ из кэша вместе с признаком устаревания
+// и отмечает обращение к нему для политики вытеснения
+func (c *Cache) GetOrderEntry(ctx context.Context, uid string) *CachedOrder {
+	entry := c.getOrderEntry(ctx, uid)
+	if entry == nil {
+		return nil
+	}
+	return &CachedOrder{Order: entry.Order, Stale: entry.stale()}
+}
+
+// getOrderEntry читает запись заказа из Redis
+func (c *Cache) getOrderEntry(ctx context.Context, uid string) *cachedOrder {
+	val, err := getOrderScript.Run(ctx, c.client,
+		[]string{orderCacheKey(uid), evictionIndexKey, expiryIndexKey, lfuAgingKey},
+		uid, c.evictionPolicy, now(), c.lfuDecayPeriod.Microseconds()).Text()
 	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			slog.Error("failed to get order from cache", "uid", uid, "error", err)
+		}
+		c.misses.Add(1)
+		metrics.CacheLookups.WithLabelValues(tierRedis, "miss").Inc()
 		return nil
 	}
 
-	var order model.Order
-	if err = json.Unmarshal([]byte(val), &order); err != nil {
+	// Запись старого формата (заказ без обертки) декодируется без заказа и считается промахом
+	var entry cachedOrder
+	if err = json.Unmarshal([]byte(val), &entry); err != nil || entry.Order == nil {
 		slog.Error("failed to unmarshal order from cache", "uid", uid, "error", err)
+		c.misses.Add(1)
+		metrics.CacheLookups.WithLabelValues(tierRedis, "miss").Inc()
 		return nil
 	}
 
-	return &order
+	c.hits.Add(1)
+	metrics.CacheLookups.WithLabelValues(tierRedis, "hit").Inc()
+	return &entry
 }
 
-// SetOrders сохраняет заказы в кэш, возвращает количество успешно добавленных заказов
-// если достигнуто максимальное количество заказов в кэше (см. в конфиге), то новые заказы, добавляются вместо старых
+// SetOrders сохраняет заказы в кэш с TTL из конфигурации, возвращает количество успешно добавленных заказов
+// если достигнуто максимальное количество заказов в кэше (см. в конфиге), то новые заказы добавляются вместо
+// вытесненных согласно политике вытеснения (LRU, LFU или FIFO)
 func (c *Cache) SetOrders(context context.Context, orders []*model.Order) int {
 	successAdded := 0
 
 	for _, order := range orders {
-		orderData, err := json.Marshal(order)
-		if err != nil {
-			slog.Error("failed to marshal order for cache", slog.String("uid", order.OrderUID), sl.Err(err))
-		}
-
-		if err = c.client.Set(context, fmt.Sprintf("order:%s", order.OrderUID), orderData, 0).Err(); err != nil {
+		if _, err := c.setOrder(context, order); err != nil {
+			if errors.Is(err, errStaleOrder) {
+				slog.Debug("cached order is newer, skipping", slog.String("uid", order.OrderUID))
+				continue
+			}
 			slog.Error("failed to set order in cache", slog.String("uid", order.OrderUID), sl.Err(err))
 			continue
 		}
 
-		//slog.Debug("order cached", slog.String("uid", order.OrderUID))
 		successAdded++
 	}
 
 	return successAdded
 }
 
+// errStaleOrder в кэше уже лежит более новая версия заказа, и запись пропущена
+var errStaleOrder = errors.New("cached order has a newer version")
+
+// setOrder сохраняет заказ в Redis одним обращением и возвращает сохраненную запись.
+// Если в кэше более новая версия заказа, возвращает errStaleOrder
+func (c *Cache) setOrder(ctx context.Context, order *model.Order) (*cachedOrder, error) {
+	ttl, softTTL := c.entryTTL()
+	entry := newCachedOrder(order, softTTL)
+
+	orderData, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal order: %w", err)
+	}
+
+	evicted, err := setOrderScript.Run(ctx, c.client,
+		[]string{orderCacheKey(order.OrderUID), evictionIndexKey, expiryIndexKey},
+		order.OrderUID, orderData, c.evictionPolicy, now(), c.maxOrders, orderKeyPrefix,
+		ttl.Milliseconds(), expiresAt(ttl), invalidationChannel, c.invalidationMessage(order.OrderUID),
+		order.Version, evictionSender).Int()
+	if err != nil {
+		return nil, err
+	}
+	if evicted < 0 {
+		return nil, errStaleOrder
+	}
+
+	if evicted > 0 {
+		slog.Debug("orders evicted from cache", "count", evicted, "policy", c.evictionPolicy)
+	}
+
+	return &entry, nil
+}
+
+// lookupTTL время жизни вторичных ключей: соответствие может устареть при изменении заказа,
+// поэтому такие записи не хранятся бессрочно
+const lookupTTL = 24 * time.Hour
+
+// lookupCacheKey ключ записи "вторичный ключ -> order_uid". Префикс не совпадает с order:*,
+// чтобы такие записи не учитывались как заказы в кэше
+func lookupCacheKey(key model.LookupKey, value string) string {
+	return fmt.Sprintf("lookup:%s:%s", key, value)
+}
+
+// GetOrderUIDByLookup возвращает order_uid, сохраненный для вторичного ключа
+func (c *Cache) GetOrderUIDByLookup(ctx context.Context, key model.LookupKey, value string) (string, bool) {
+	uid, err := c.client.Get(ctx, lookupCacheKey(key, value)).Result()
+	if err != nil {
+		return "", false
+	}
+	return uid, true
+}
+
+// SetOrderLookup сохраняет соответствие вторичного ключа заказу
+func (c *Cache) SetOrderLookup(ctx context.Context, key model.LookupKey, value, uid string) error {
+	return c.client.Set(ctx, lookupCacheKey(key, value), uid, lookupTTL).Err()
+}
+
 // GetCacheStats возвращает статистику кэша
 func (c *Cache) GetCacheStats(ctx context.Context) (map[string]interface{}, error) {
 	info, err := c.client.Info(ctx).Result()
@@ -112,24 +206,42 @@ func (c *Cache) GetCacheStats(ctx context.Context) (map[string]interface{}, erro
 		return nil, err
 	}
 
-	// Получаем количество ключей с префиксом order:
-	keys, err := c.client.Keys(ctx, "order:*").Result()
+	cached, err := c.CountOrders(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	stats := map[string]interface{}{
-		"cached_orders": len(keys),
-		"redis_info":    info,
+		"cached_orders":   cached,
+		"max_orders":      c.maxOrders,
+		"eviction_policy": c.evictionPolicy,
+		"redis_hit_ratio": hitRatio(c.hits.Load(), c.misses.Load()),
+		"redis_info":      info,
 	}
 
 	return stats, nil
 }
 
-// GetAllKeys возвращает все ключи, соответствующие заданному шаблону
+// CountOrders возвращает количество заказов в кэше по индексу вытеснения (без обхода ключей).
+// Заказы с истекшим TTL предварительно убираются из индекса и не учитываются
+func (c *Cache) CountOrders(ctx context.Context) (int64, error) {
+	return countOrdersScript.Run(ctx, c.client, []string{evictionIndexKey, expiryIndexKey}, now()).Int64()
+}
+
+// scanBatchSize количество ключей, запрашиваемых у Redis за одну итерацию SCAN
+const scanBatchSize = 1000
+
+// GetAllKeys возвращает все ключи, соответствующие заданному шаблону.
+// Ключи обходятся курсором SCAN, не блокируя Redis, но за O(N) обращений -
+// метод предназначен только для административных задач, а не для горячего пути
 func (c *Cache) GetAllKeys(ctx context.Context, pattern string) ([]string, error) {
-	keys, err := c.client.Keys(ctx, pattern).Result()
-	if err != nil {
+	var keys []string
+
+	iter := c.client.Scan(ctx, 0, pattern, scanBatchSize).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
 		return nil, err
 	}
 
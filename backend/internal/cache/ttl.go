@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// CachedOrder заказ из кэша вместе с признаком устаревания
+type CachedOrder struct {
+	Order *model.Order
+	// Stale запись старше мягкого TTL: ее можно отдать, но нужно обновить из базы
+	Stale bool
+}
+
+// cachedOrder формат записи заказа в Redis
+type cachedOrder struct {
+	Order *model.Order `json:"order"`
+	// FreshUntil момент (unix, мс), после которого запись считается устаревшей; 0 - не устаревает
+	FreshUntil int64 `json:"fresh_until,omitempty"`
+}
+
+// entryTTL возвращает жесткий и мягкий TTL новой записи. Оба TTL случайно растягиваются
+// или сокращаются на долю ttlJitter, чтобы записи, сохраненные одновременно, не истекали вместе
+func (c *Cache) entryTTL() (ttl, softTTL time.Duration) {
+	factor := 1 + c.ttlJitter*(2*rand.Float64()-1)
+
+	if c.orderTTL > 0 {
+		ttl = time.Duration(float64(c.orderTTL) * factor)
+	}
+	if c.staleWhileRevalidate {
+		softTTL = time.Duration(float64(c.softTTL) * factor)
+	}
+
+	return ttl, softTTL
+}
+
+// newCachedOrder оборачивает заказ в запись кэша с моментом устаревания
+func newCachedOrder(order *model.Order, softTTL time.Duration) cachedOrder {
+	entry := cachedOrder{Order: order}
+	if softTTL > 0 {
+		entry.FreshUntil = time.Now().Add(softTTL).UnixMilli()
+	}
+	return entry
+}
+
+// stale проверяет, истек ли мягкий TTL записи
+func (e cachedOrder) stale() bool {
+	return e.FreshUntil > 0 && time.Now().UnixMilli() > e.FreshUntil
+}
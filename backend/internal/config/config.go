@@ -4,6 +4,8 @@ import (
 	"log/slog"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 )
@@ -14,14 +16,44 @@ type Config struct {
 	DB          Database
 	Redis       Redis
 	Kafka       Kafka
+	Retention   Retention
 }
 
 type Redis struct {
 	Host      string
 	Port      int
 	MaxOrders int
+	// EvictionPolicy политика вытеснения заказов при заполнении кэша: lru, lfu или fifo
+	EvictionPolicy string
+	// LFUDecayPeriod период полураспада числа обращений к заказу для политики lfu,
+	// чтобы заказы, популярные в прошлом, со временем уступали место новым
+	LFUDecayPeriod time.Duration
+	// OrderTTL время жизни заказа в кэше (0 - без истечения)
+	OrderTTL time.Duration
+	// TTLJitter доля случайного разброса TTL (0.1 - ±10%), чтобы записи не истекали одновременно
+	TTLJitter float64
+	// StaleWhileRevalidate отдавать запись старше SoftTTL, обновляя ее из базы в фоне
+	StaleWhileRevalidate bool
+	// SoftTTL время, после которого запись считается устаревшей в режиме StaleWhileRevalidate
+	SoftTTL time.Duration
+	// L1Enabled включает кэш заказов в памяти процесса перед Redis
+	L1Enabled bool
+	// L1MaxOrders максимальное количество заказов в кэше процесса
+	L1MaxOrders int
+	// L1TTL время жизни заказа в кэше процесса; ограничивает устаревание, если инвалидация не дошла
+	L1TTL time.Duration
 }
 
+// Политики вытеснения заказов из кэша
+const (
+	// EvictionLRU вытесняет заказы, к которым дольше всего не обращались
+	EvictionLRU = "lru"
+	// EvictionLFU вытесняет заказы с наименьшим числом чтений (счетчики со временем затухают)
+	EvictionLFU = "lfu"
+	// EvictionFIFO вытесняет заказы, раньше всех добавленные в кэш
+	EvictionFIFO = "fifo"
+)
+
 type Database struct {
 	Host     string
 	Db       string
@@ -34,6 +66,44 @@ type Kafka struct {
 	Brokers []string
 	Topic   string
 	GroupID string
+
+	// DLQTopic топик, куда отправляются сообщения, которые не удалось обработать
+	DLQTopic string
+	// MaxRetries количество повторных попыток обработки одного сообщения
+	MaxRetries int
+	// RetryBackoff начальная задержка между попытками, удваивается с каждой попыткой
+	RetryBackoff time.Duration
+	// RetryMaxBackoff верхняя граница задержки между попытками
+	RetryMaxBackoff time.Duration
+
+	// Workers количество воркеров, параллельно обрабатывающих сообщения
+	Workers int
+	// WorkerQueueSize размер очереди сообщений каждого воркера
+	WorkerQueueSize int
+
+	// BatchSize максимальное количество сообщений, сохраняемых одним пакетом (1 - без пакетов)
+	BatchSize int
+	// BatchTimeout максимальное время накопления пакета
+	BatchTimeout time.Duration
+
+	// OutboxTopic топик для событий об изменении заказов
+	OutboxTopic string
+	// OutboxPollInterval интервал опроса таблицы outbox
+	OutboxPollInterval time.Duration
+	// OutboxBatchSize максимальное количество событий, публикуемых за один проход
+	OutboxBatchSize int
+}
+
+type Retention struct {
+	// Enabled запускать задачу архивации вместе с приложением
+	Enabled bool
+	// ArchiveAfter возраст заказа, после которого он переносится в архив.
+	// Удаленные заказы архивируются не раньше, чем через ArchiveAfter после удаления
+	ArchiveAfter time.Duration
+	// Interval интервал запуска архивации
+	Interval time.Duration
+	// BatchSize количество заказов, архивируемых одной транзакцией
+	BatchSize int
 }
 
 func GetConfig() *Config {
@@ -51,11 +121,44 @@ func GetConfig() *Config {
 			Host:      getEnv("REDIS_HOST", "localhost"),
 			Port:      getEnvAsInt("REDIS_PORT", 6379),
 			MaxOrders: getEnvAsInt("REDIS_MAX_ORDERS", 100),
+
+			EvictionPolicy: strings.ToLower(getEnv("REDIS_EVICTION_POLICY", EvictionLRU)),
+			LFUDecayPeriod: getEnvAsDuration("REDIS_LFU_DECAY_PERIOD", time.Hour),
+
+			OrderTTL:             getEnvAsDuration("REDIS_ORDER_TTL", 24*time.Hour),
+			TTLJitter:            getEnvAsFloat("REDIS_ORDER_TTL_JITTER", 0.1),
+			StaleWhileRevalidate: getEnvAsBool("REDIS_STALE_WHILE_REVALIDATE", false),
+			SoftTTL:              getEnvAsDuration("REDIS_ORDER_SOFT_TTL", 5*time.Minute),
+
+			L1Enabled:   getEnvAsBool("REDIS_L1_ENABLED", false),
+			L1MaxOrders: getEnvAsInt("REDIS_L1_MAX_ORDERS", 1000),
+			L1TTL:       getEnvAsDuration("REDIS_L1_TTL", 30*time.Second),
 		},
 		Kafka: Kafka{
 			Brokers: []string{getEnv("KAFKA_BROKERS", "localhost:9092")},
 			Topic:   getEnv("KAFKA_TOPIC", "orders"),
 			GroupID: getEnv("KAFKA_GROUP_ID", "wildberries-consumer"),
+
+			DLQTopic:        getEnv("KAFKA_DLQ_TOPIC", "orders.dlq"),
+			MaxRetries:      getEnvAsInt("KAFKA_MAX_RETRIES", 3),
+			RetryBackoff:    getEnvAsDuration("KAFKA_RETRY_BACKOFF", 200*time.Millisecond),
+			RetryMaxBackoff: getEnvAsDuration("KAFKA_RETRY_MAX_BACKOFF", 5*time.Second),
+
+			Workers:         getEnvAsInt("KAFKA_WORKERS", 4),
+			WorkerQueueSize: getEnvAsInt("KAFKA_WORKER_QUEUE_SIZE", 100),
+
+			BatchSize:    getEnvAsInt("KAFKA_BATCH_SIZE", 1),
+			BatchTimeout: getEnvAsDuration("KAFKA_BATCH_TIMEOUT", 500*time.Millisecond),
+
+			OutboxTopic:        getEnv("KAFKA_OUTBOX_TOPIC", "orders.events"),
+			OutboxPollInterval: getEnvAsDuration("KAFKA_OUTBOX_POLL_INTERVAL", time.Second),
+			OutboxBatchSize:    getEnvAsInt("KAFKA_OUTBOX_BATCH_SIZE", 100),
+		},
+		Retention: Retention{
+			Enabled:      getEnvAsBool("RETENTION_ENABLED", false),
+			ArchiveAfter: getEnvAsDuration("RETENTION_ARCHIVE_AFTER", 90*24*time.Hour),
+			Interval:     getEnvAsDuration("RETENTION_INTERVAL", time.Hour),
+			BatchSize:    getEnvAsInt("RETENTION_BATCH_SIZE", 500),
 		},
 	}
 
@@ -64,6 +167,73 @@ func GetConfig() *Config {
 		os.Exit(1)
 	}
 
+	if conf.Redis.OrderTTL < 0 || conf.Redis.TTLJitter < 0 || conf.Redis.TTLJitter >= 1 {
+		slog.Error("REDIS_ORDER_TTL cannot be negative and REDIS_ORDER_TTL_JITTER must be in [0, 1)")
+		os.Exit(1)
+	}
+
+	if conf.Redis.StaleWhileRevalidate &&
+		(conf.Redis.SoftTTL <= 0 || (conf.Redis.OrderTTL > 0 && conf.Redis.SoftTTL >= conf.Redis.OrderTTL)) {
+		slog.Error("REDIS_ORDER_SOFT_TTL must be positive and less than REDIS_ORDER_TTL")
+		os.Exit(1)
+	}
+
+	if conf.Redis.L1Enabled && (conf.Redis.L1MaxOrders < 1 || conf.Redis.L1TTL <= 0) {
+		slog.Error("REDIS_L1_MAX_ORDERS must be at least 1 and REDIS_L1_TTL must be positive")
+		os.Exit(1)
+	}
+
+	switch conf.Redis.EvictionPolicy {
+	case EvictionLRU, EvictionLFU, EvictionFIFO:
+	default:
+		slog.Error("REDIS_EVICTION_POLICY must be one of lru, lfu, fifo")
+		os.Exit(1)
+	}
+
+	if conf.Redis.EvictionPolicy == EvictionLFU && conf.Redis.LFUDecayPeriod <= 0 {
+		slog.Error("REDIS_LFU_DECAY_PERIOD must be positive")
+		os.Exit(1)
+	}
+
+	if conf.Kafka.MaxRetries < 0 {
+		slog.Error("KAFKA_MAX_RETRIES cannot be negative")
+		os.Exit(1)
+	}
+
+	if conf.Kafka.RetryBackoff <= 0 || conf.Kafka.RetryMaxBackoff < conf.Kafka.RetryBackoff {
+		slog.Error("KAFKA_RETRY_BACKOFF must be positive and KAFKA_RETRY_MAX_BACKOFF cannot be less than it")
+		os.Exit(1)
+	}
+
+	// Без DLQ сообщение, которое не удалось обработать, некуда сохранить
+	if conf.Kafka.DLQTopic == "" {
+		slog.Error("KAFKA_DLQ_TOPIC cannot be empty")
+		os.Exit(1)
+	}
+
+	if conf.Kafka.Workers < 1 || conf.Kafka.WorkerQueueSize < 0 {
+		slog.Error("KAFKA_WORKERS must be at least 1 and KAFKA_WORKER_QUEUE_SIZE cannot be negative")
+		os.Exit(1)
+	}
+
+	// Таймаут ожидания пачки используется, только когда пачка больше одного сообщения
+	if conf.Kafka.BatchSize < 1 || (conf.Kafka.BatchSize > 1 && conf.Kafka.BatchTimeout <= 0) {
+		slog.Error("KAFKA_BATCH_SIZE must be at least 1 and KAFKA_BATCH_TIMEOUT must be positive")
+		os.Exit(1)
+	}
+
+	if conf.Kafka.OutboxPollInterval <= 0 || conf.Kafka.OutboxBatchSize < 1 {
+		slog.Error("KAFKA_OUTBOX_POLL_INTERVAL must be positive and KAFKA_OUTBOX_BATCH_SIZE must be at least 1")
+		os.Exit(1)
+	}
+
+	// Отдельно запускаемый архиватор проверяет свои настройки сам
+	if conf.Retention.Enabled &&
+		(conf.Retention.ArchiveAfter <= 0 || conf.Retention.Interval <= 0 || conf.Retention.BatchSize < 1) {
+		slog.Error("RETENTION_ARCHIVE_AFTER and RETENTION_INTERVAL must be positive and RETENTION_BATCH_SIZE must be at least 1")
+		os.Exit(1)
+	}
+
 	return conf
 }
 
@@ -83,5 +253,32 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
 // dsads
 // ds
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	errors2 "github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// ArchiveOrders переносит в orders_archive до limit заказов старше olderThan
+// (удаленные - если и удалены раньше, чем olderThan назад), и удаляет их из рабочих таблиц.
+// Возвращает UID заархивированных заказов
+func (db *Database) ArchiveOrders(ctx context.Context, olderThan time.Duration, limit int) ([]string, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors2.NewDatabaseError("begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	// Граница считается на стороне базы, так как created_at и deleted_at хранятся без часового пояса.
+	// SKIP LOCKED позволяет запускать архивацию параллельно с изменением заказов и другими архиваторами
+	query := `
+		WITH cutoff AS (
+			SELECT CURRENT_TIMESTAMP::timestamp - make_interval(secs => $1) AS at
+		)
+		SELECT o.id, o.deleted_at
+		FROM orders o, cutoff c
+		WHERE o.created_at < c.at AND (o.deleted_at IS NULL OR o.deleted_at < c.at)
+		ORDER BY o.id
+		LIMIT $2
+		FOR UPDATE OF o SKIP LOCKED`
+
+	rows, err := tx.QueryContext(ctx, query, olderThan.Seconds(), limit)
+	if err != nil {
+		return nil, errors2.NewDatabaseError("select orders to archive", err)
+	}
+
+	var ids []int64
+	deletedAt := make(map[int]sql.NullTime)
+	for rows.Next() {
+		var id int
+		var deleted sql.NullTime
+		if err = rows.Scan(&id, &deleted); err != nil {
+			rows.Close()
+			return nil, errors2.NewDatabaseError("scan order to archive", err)
+		}
+		ids = append(ids, int64(id))
+		deletedAt[id] = deleted
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, errors2.NewDatabaseError("iterate orders to archive", err)
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	orders, err := queryOrders(ctx, tx, orderSelectQuery+"\n\tWHERE o.id = ANY($1)\n\tORDER BY o.id", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = insertArchiveRows(ctx, tx, orders, deletedAt); err != nil {
+		return nil, err
+	}
+
+	// Доставка, платежи и товары удаляются каскадно
+	if _, err = tx.ExecContext(ctx, `DELETE FROM orders WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+		return nil, errors2.NewDatabaseError("delete archived orders", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, errors2.NewDatabaseError("commit transaction", err)
+	}
+
+	uids := make([]string, len(orders))
+	for i, order := range orders {
+		uids[i] = order.OrderUID
+	}
+
+	return uids, nil
+}
+
+// insertArchiveRows записывает снимки заказов в orders_archive
+func insertArchiveRows(ctx context.Context, tx *sql.Tx, orders []*model.Order, deletedAt map[int]sql.NullTime) error {
+	const columns = 4
+
+	for _, chunk := range chunkIndexes(len(orders), columns) {
+		args := make([]interface{}, 0, len(chunk)*columns)
+		for _, i := range chunk {
+			order := orders[i]
+			snapshot, err := json.Marshal(order)
+			if err != nil {
+				return errors2.NewDatabaseError("marshal archive snapshot", err)
+			}
+			args = append(args, order.OrderUID, snapshot, order.CreatedAt, deletedAt[order.ID])
+		}
+
+		query := fmt.Sprintf(`INSERT INTO orders_archive (order_uid, snapshot, created_at, deleted_at) VALUES %s`,
+			valuesPlaceholders(len(chunk), columns))
+
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return errors2.NewDatabaseError("insert archive rows", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,393 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/lib/pq"
+
+	errors2 "github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+	"github.com/makhkets/wildberries-l0/pkg/lib/logger/sl"
+)
+
+// maxQueryParams ограничение PostgreSQL на количество параметров в одном запросе
+const maxQueryParams = 65535
+
+// CreateOrders создает несколько заказов в одной транзакции с помощью многострочных INSERT.
+// Возвращает срез ошибок той же длины, что и orders: nil для созданного заказа,
+// ConflictError для уже существующего, DuplicateMessageError для заказа из уже обработанного
+// сообщения. Если пакетная вставка не удалась целиком
+// (например, из-за некорректных данных одного из заказов), заказы вставляются по одному,
+// чтобы ошибка одного заказа не мешала сохранению остальных
+func (db *Database) CreateOrders(ctx context.Context, orders []*model.Order) []error {
+	results := make([]error, len(orders))
+	if len(orders) == 0 {
+		return results
+	}
+
+	if err := db.createOrdersBatch(ctx, orders, results); err != nil {
+		slog.Warn("Batch insert failed, falling back to per-order inserts",
+			slog.Int("orders", len(orders)), sl.Err(err))
+
+		for i, order := range orders {
+			results[i] = db.CreateOrder(ctx, order)
+		}
+	}
+
+	return results
+}
+
+// createOrdersBatch вставляет заказы, доставку, платежи и товары многострочными запросами
+func (db *Database) createOrdersBatch(ctx context.Context, orders []*model.Order, results []error) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return errors2.NewDatabaseError("begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	// Создаем основные заказы; уже существующие пропускаются и помечаются как конфликт
+	inserted, err := insertOrderRows(ctx, tx, orders)
+	if err != nil {
+		return err
+	}
+
+	created := make([]*model.Order, 0, len(orders))
+	createdIndexes := make([]int, 0, len(orders))
+	for i, order := range orders {
+		if !inserted[i] {
+			results[i] = errors2.NewConflictError("order")
+			continue
+		}
+		created = append(created, order)
+		createdIndexes = append(createdIndexes, i)
+	}
+
+	// Заказы из уже обработанных сообщений помечаются как повтор и удаляются из пакета,
+	// остальные заказы пакета сохраняются
+	recorded, err := insertProcessedMessageRows(ctx, tx, created)
+	if err != nil {
+		return err
+	}
+
+	var duplicateIDs []int64
+	kept := created[:0]
+	for j, order := range created {
+		if !recorded[j] {
+			results[createdIndexes[j]] = errors2.NewDuplicateMessageError()
+			duplicateIDs = append(duplicateIDs, int64(order.ID))
+			continue
+		}
+		kept = append(kept, order)
+	}
+	created = kept
+
+	if err = deleteOrderRows(ctx, tx, duplicateIDs); err != nil {
+		return err
+	}
+
+	if err = insertDeliveryRows(ctx, tx, created); err != nil {
+		return err
+	}
+
+	if err = insertPaymentRows(ctx, tx, created); err != nil {
+		return err
+	}
+
+	if err = insertItemRows(ctx, tx, created); err != nil {
+		return err
+	}
+
+	if err = insertHistoryRows(ctx, tx, created); err != nil {
+		return err
+	}
+
+	if err = insertOutboxRows(ctx, tx, created); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors2.NewDatabaseError("commit transaction", err)
+	}
+
+	return nil
+}
+
+// insertOrderRows вставляет строки orders и возвращает признак вставки для каждого заказа
+func insertOrderRows(ctx context.Context, tx *sql.Tx, orders []*model.Order) ([]bool, error) {
+	const columns = 11
+	inserted := make([]bool, len(orders))
+
+	for _, chunk := range chunkIndexes(len(orders), columns) {
+		args := make([]interface{}, 0, len(chunk)*columns)
+		for _, i := range chunk {
+			order := orders[i]
+			args = append(args,
+				order.OrderUID, order.TrackNumber, order.Entry, order.Locale,
+				order.InternalSignature, order.CustomerID, order.DeliveryService,
+				order.Shardkey, order.SmID, order.DateCreated, order.OofShard,
+			)
+		}
+
+		query := fmt.Sprintf(`
+			INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature,
+			                   customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard)
+			VALUES %s
+			ON CONFLICT (order_uid) DO NOTHING
+			RETURNING id, order_uid, created_at, updated_at, version, status`, valuesPlaceholders(len(chunk), columns))
+
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, errors2.NewDatabaseError("insert orders batch", err)
+		}
+
+		// Индекс первого заказа с данным UID в текущей части пакета: повторные UID считаются конфликтом
+		byUID := make(map[string]int, len(chunk))
+		for _, i := range chunk {
+			if _, ok := byUID[orders[i].OrderUID]; !ok {
+				byUID[orders[i].OrderUID] = i
+			}
+		}
+
+		for rows.Next() {
+			var uid string
+			var row model.Order
+			if err = rows.Scan(&row.ID, &uid, &row.CreatedAt, &row.UpdatedAt, &row.Version, &row.Status); err != nil {
+				rows.Close()
+				return nil, errors2.NewDatabaseError("scan inserted order", err)
+			}
+
+			i := byUID[uid]
+			orders[i].ID, orders[i].CreatedAt, orders[i].UpdatedAt = row.ID, row.CreatedAt, row.UpdatedAt
+			orders[i].Version, orders[i].Status = row.Version, row.Status
+			inserted[i] = true
+		}
+		rows.Close()
+
+		if err = rows.Err(); err != nil {
+			return nil, errors2.NewDatabaseError("iterate inserted orders", err)
+		}
+	}
+
+	return inserted, nil
+}
+
+// deleteOrderRows удаляет строки orders, вставленные в текущей транзакции
+func deleteOrderRows(ctx context.Context, tx *sql.Tx, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM orders WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+		return errors2.NewDatabaseError("delete duplicate orders", err)
+	}
+	return nil
+}
+
+// insertDeliveryRows вставляет данные доставки созданных заказов
+func insertDeliveryRows(ctx context.Context, tx *sql.Tx, orders []*model.Order) error {
+	const columns = 8
+
+	withDelivery := make([]*model.Order, 0, len(orders))
+	for _, order := range orders {
+		if order.Delivery != nil && order.Delivery.Name != "" {
+			withDelivery = append(withDelivery, order)
+		}
+	}
+
+	for _, chunk := range chunkIndexes(len(withDelivery), columns) {
+		args := make([]interface{}, 0, len(chunk)*columns)
+		for _, i := range chunk {
+			order := withDelivery[i]
+			args = append(args,
+				order.ID, order.Delivery.Name, order.Delivery.Phone,
+				order.Delivery.Zip, order.Delivery.City, order.Delivery.Address,
+				order.Delivery.Region, order.Delivery.Email,
+			)
+		}
+
+		query := fmt.Sprintf(`
+			INSERT INTO delivery (order_id, name, phone, zip, city, address, region, email)
+			VALUES %s
+			RETURNING id, order_id`, valuesPlaceholders(len(chunk), columns))
+
+		ids, err := queryIDsByOrder(ctx, tx, query, args)
+		if err != nil {
+			return errors2.NewDatabaseError("insert delivery batch", err)
+		}
+
+		for _, i := range chunk {
+			order := withDelivery[i]
+			order.Delivery.ID = ids[order.ID]
+			order.Delivery.OrderID = order.ID
+		}
+	}
+
+	return nil
+}
+
+// insertPaymentRows вставляет данные платежей созданных заказов
+func insertPaymentRows(ctx context.Context, tx *sql.Tx, orders []*model.Order) error {
+	const columns = 11
+
+	withPayment := make([]*model.Order, 0, len(orders))
+	for _, order := range orders {
+		if order.Payment != nil && order.Payment.Transaction != "" {
+			withPayment = append(withPayment, order)
+		}
+	}
+
+	for _, chunk := range chunkIndexes(len(withPayment), columns) {
+		args := make([]interface{}, 0, len(chunk)*columns)
+		for _, i := range chunk {
+			order := withPayment[i]
+			args = append(args,
+				order.ID, order.Payment.Transaction, order.Payment.RequestID,
+				order.Payment.Currency, order.Payment.Provider, order.Payment.Amount,
+				order.Payment.PaymentDt, order.Payment.Bank, order.Payment.DeliveryCost,
+				order.Payment.GoodsTotal, order.Payment.CustomFee,
+			)
+		}
+
+		query := fmt.Sprintf(`
+			INSERT INTO payment (order_id, transaction, request_id, currency, provider,
+			                    amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
+			VALUES %s
+			RETURNING id, order_id`, valuesPlaceholders(len(chunk), columns))
+
+		ids, err := queryIDsByOrder(ctx, tx, query, args)
+		if err != nil {
+			return errors2.NewDatabaseError("insert payment batch", err)
+		}
+
+		for _, i := range chunk {
+			order := withPayment[i]
+			order.Payment.ID = ids[order.ID]
+			order.Payment.OrderID = order.ID
+			// Статус не передается при вставке и принимает значение по умолчанию
+			order.Payment.Status = model.PaymentStatusPending
+		}
+	}
+
+	return nil
+}
+
+// insertItemRows вставляет товарные позиции созданных заказов
+func insertItemRows(ctx context.Context, tx *sql.Tx, orders []*model.Order) error {
+	const columns = 12
+
+	var items []*model.Item
+	for _, order := range orders {
+		for i := range order.Items {
+			order.Items[i].OrderID = order.ID
+			items = append(items, &order.Items[i])
+		}
+	}
+
+	for _, chunk := range chunkIndexes(len(items), columns) {
+		args := make([]interface{}, 0, len(chunk)*columns)
+		for _, i := range chunk {
+			item := items[i]
+			args = append(args,
+				item.OrderID, item.ChrtID, item.TrackNumber, item.Price, item.RID,
+				item.Name, item.Sale, item.Size, item.TotalPrice, item.NmID,
+				item.Brand, item.Status,
+			)
+		}
+
+		// Для многострочного INSERT ... VALUES PostgreSQL возвращает строки RETURNING
+		// в порядке вставки, поэтому идентификаторы сопоставляются по позиции
+		query := fmt.Sprintf(`
+			INSERT INTO items (order_id, chrt_id, track_number, price, rid, name,
+			                  sale, size, total_price, nm_id, brand, status)
+			VALUES %s
+			RETURNING id`, valuesPlaceholders(len(chunk), columns))
+
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return errors2.NewDatabaseError("insert items batch", err)
+		}
+
+		n := 0
+		for rows.Next() {
+			if n >= len(chunk) {
+				break
+			}
+			if err = rows.Scan(&items[chunk[n]].ID); err != nil {
+				rows.Close()
+				return errors2.NewDatabaseError("scan inserted item", err)
+			}
+			n++
+		}
+		rows.Close()
+
+		if err = rows.Err(); err != nil {
+			return errors2.NewDatabaseError("iterate inserted items", err)
+		}
+	}
+
+	return nil
+}
+
+// queryIDsByOrder выполняет INSERT ... RETURNING id, order_id и возвращает id по order_id
+func queryIDsByOrder(ctx context.Context, tx *sql.Tx, query string, args []interface{}) (map[int]int, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[int]int)
+	for rows.Next() {
+		var id, orderID int
+		if err = rows.Scan(&id, &orderID); err != nil {
+			return nil, err
+		}
+		ids[orderID] = id
+	}
+
+	return ids, rows.Err()
+}
+
+// valuesPlaceholders строит список "($1, $2), ($3, $4)" для многострочного INSERT
+func valuesPlaceholders(rowsCount, columns int) string {
+	var b strings.Builder
+	for r := 0; r < rowsCount; r++ {
+		if r > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for c := 0; c < columns; c++ {
+			if c > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d", r*columns+c+1)
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// chunkIndexes разбивает индексы [0, n) на части так, чтобы в одном запросе
+// не превысить ограничение на количество параметров
+func chunkIndexes(n, columns int) [][]int {
+	size := maxQueryParams / columns
+
+	var chunks [][]int
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+
+		chunk := make([]int, 0, end-start)
+		for i := start; i < end; i++ {
+			chunk = append(chunk, i)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	errors2 "github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// historyColumns количество колонок, записываемых в order_history
+const historyColumns = 9
+
+// insertHistoryEntry записывает снимок заказа в историю изменений в рамках транзакции заказа
+func insertHistoryEntry(ctx context.Context, tx *sql.Tx, eventType string, order *model.Order) error {
+	args, err := historyArgs(eventType, order)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO order_history (order_uid, version, event_type, source, kafka_topic,
+		                           kafka_partition, kafka_offset, request_id, snapshot)
+		VALUES %s`, valuesPlaceholders(1, historyColumns))
+
+	if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+		return errors2.NewDatabaseError("insert order history", err)
+	}
+
+	return nil
+}
+
+// insertHistoryRows записывает снимки заказов, созданных пакетом
+func insertHistoryRows(ctx context.Context, tx *sql.Tx, orders []*model.Order) error {
+	for _, chunk := range chunkIndexes(len(orders), historyColumns) {
+		args := make([]interface{}, 0, len(chunk)*historyColumns)
+		for _, i := range chunk {
+			rowArgs, err := historyArgs(model.EventOrderCreated, orders[i])
+			if err != nil {
+				return err
+			}
+			args = append(args, rowArgs...)
+		}
+
+		query := fmt.Sprintf(`
+			INSERT INTO order_history (order_uid, version, event_type, source, kafka_topic,
+			                           kafka_partition, kafka_offset, request_id, snapshot)
+			VALUES %s`, valuesPlaceholders(len(chunk), historyColumns))
+
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return errors2.NewDatabaseError("insert order history batch", err)
+		}
+	}
+
+	return nil
+}
+
+// historyArgs возвращает значения колонок order_history для заказа. Источником изменения
+// считается Kafka, если у заказа есть исходное сообщение, иначе HTTP
+func historyArgs(eventType string, order *model.Order) ([]interface{}, error) {
+	snapshot, err := json.Marshal(order)
+	if err != nil {
+		return nil, errors2.NewDatabaseError("marshal order snapshot", err)
+	}
+
+	var (
+		source    = model.ChangeSourceHTTP
+		topic     sql.NullString
+		partition sql.NullInt64
+		offset    sql.NullInt64
+		requestID = sql.NullString{String: order.RequestID, Valid: order.RequestID != ""}
+	)
+
+	if order.Source != nil {
+		source = model.ChangeSourceKafka
+		topic = sql.NullString{String: order.Source.Topic, Valid: true}
+		partition = sql.NullInt64{Int64: int64(order.Source.Partition), Valid: true}
+		offset = sql.NullInt64{Int64: order.Source.Offset, Valid: true}
+	}
+
+	return []interface{}{
+		order.OrderUID, order.Version, eventType, source, topic,
+		partition, offset, requestID, snapshot,
+	}, nil
+}
+
+// GetOrderHistory возвращает до limit последних изменений заказа, начиная с самого нового
+func (db *Database) GetOrderHistory(ctx context.Context, uid string, limit int) ([]model.OrderHistoryEntry, error) {
+	query := `
+		SELECT id, order_uid, version, event_type, source, kafka_topic,
+		       kafka_partition, kafka_offset, request_id, snapshot, created_at
+		FROM order_history
+		WHERE order_uid = $1
+		ORDER BY id DESC
+		LIMIT $2`
+
+	rows, err := db.DB.QueryContext(ctx, query, uid, limit)
+	if err != nil {
+		return nil, errors2.NewDatabaseError("get order history", err)
+	}
+	defer rows.Close()
+
+	entries := make([]model.OrderHistoryEntry, 0)
+	for rows.Next() {
+		var (
+			entry     model.OrderHistoryEntry
+			topic     sql.NullString
+			partition sql.NullInt64
+			offset    sql.NullInt64
+			requestID sql.NullString
+		)
+
+		err = rows.Scan(
+			&entry.ID, &entry.OrderUID, &entry.Version, &entry.EventType, &entry.Source,
+			&topic, &partition, &offset, &requestID, &entry.Snapshot, &entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, errors2.NewDatabaseError("scan order history", err)
+		}
+
+		entry.KafkaTopic = topic.String
+		entry.RequestID = requestID.String
+		if partition.Valid {
+			p := int(partition.Int64)
+			entry.KafkaPartition = &p
+		}
+		if offset.Valid {
+			entry.KafkaOffset = &offset.Int64
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors2.NewDatabaseError("iterate order history", err)
+	}
+
+	return entries, nil
+}
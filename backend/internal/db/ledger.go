@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	errors2 "github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// IsMessageProcessed проверяет, было ли сообщение Kafka уже обработано
+func (db *Database) IsMessageProcessed(ctx context.Context, source *model.MessageSource) (bool, error) {
+	query := `SELECT 1 FROM processed_messages WHERE topic = $1 AND partition = $2 AND "offset" = $3`
+
+	var exists int
+	err := db.DB.QueryRowContext(ctx, query, source.Topic, source.Partition, source.Offset).Scan(&exists)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, errors2.NewDatabaseError("check processed message", err)
+	}
+
+	return true, nil
+}
+
+// recordMessage записывает сообщение, из которого получен заказ, в журнал обработанных сообщений
+// в рамках транзакции сохранения заказа. Если сообщение уже записано, возвращает DuplicateMessageError
+func recordMessage(ctx context.Context, tx *sql.Tx, order *model.Order) error {
+	if order.Source == nil {
+		return nil
+	}
+
+	query := `
+		INSERT INTO processed_messages (topic, partition, "offset", message_key, content_hash, order_uid)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (topic, partition, "offset") DO NOTHING`
+
+	result, err := tx.ExecContext(ctx, query,
+		order.Source.Topic, order.Source.Partition, order.Source.Offset,
+		order.Source.Key, order.Source.ContentHash, order.OrderUID,
+	)
+	if err != nil {
+		return errors2.NewDatabaseError("record processed message", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors2.NewDatabaseError("record processed message", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors2.NewDuplicateMessageError()
+	}
+
+	return nil
+}
+
+// messageID адрес сообщения Kafka - первичный ключ журнала обработанных сообщений
+type messageID struct {
+	topic     string
+	partition int
+	offset    int64
+}
+
+// insertProcessedMessageRows записывает в журнал сообщения созданных пакетом заказов.
+// Возвращает признак записи для каждого заказа: false означает, что сообщение заказа
+// уже есть в журнале (обработано ранее). Заказы без источника считаются записанными
+func insertProcessedMessageRows(ctx context.Context, tx *sql.Tx, orders []*model.Order) ([]bool, error) {
+	const columns = 6
+	recorded := make([]bool, len(orders))
+
+	withSource := make([]int, 0, len(orders))
+	for i, order := range orders {
+		if order.Source == nil {
+			recorded[i] = true
+			continue
+		}
+		withSource = append(withSource, i)
+	}
+
+	for _, chunk := range chunkIndexes(len(withSource), columns) {
+		args := make([]interface{}, 0, len(chunk)*columns)
+		byMessage := make(map[messageID]int, len(chunk))
+		for _, j := range chunk {
+			i := withSource[j]
+			source := orders[i].Source
+			args = append(args,
+				source.Topic, source.Partition, source.Offset,
+				source.Key, source.ContentHash, orders[i].OrderUID,
+			)
+			byMessage[messageID{source.Topic, source.Partition, source.Offset}] = i
+		}
+
+		query := fmt.Sprintf(`
+			INSERT INTO processed_messages (topic, partition, "offset", message_key, content_hash, order_uid)
+			VALUES %s
+			ON CONFLICT (topic, partition, "offset") DO NOTHING
+			RETURNING topic, partition, "offset"`, valuesPlaceholders(len(chunk), columns))
+
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, errors2.NewDatabaseError("insert processed messages batch", err)
+		}
+
+		for rows.Next() {
+			var id messageID
+			if err = rows.Scan(&id.topic, &id.partition, &id.offset); err != nil {
+				rows.Close()
+				return nil, errors2.NewDatabaseError("scan processed message", err)
+			}
+			recorded[byMessage[id]] = true
+		}
+		rows.Close()
+
+		if err = rows.Err(); err != nil {
+			return nil, errors2.NewDatabaseError("iterate processed messages", err)
+		}
+	}
+
+	return recorded, nil
+}
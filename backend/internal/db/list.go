@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// ListOrders возвращает страницу заказов, отсортированных по (created_at, id) по убыванию.
+// Пагинация по курсору (keyset): следующая страница начинается после filter.After
+func (db *Database) ListOrders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, error) {
+	var (
+		conditions = []string{"o.deleted_at IS NULL"}
+		args       []interface{}
+	)
+
+	// arg добавляет значение в список параметров и возвращает его плейсхолдер
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.CustomerID != "" {
+		conditions = append(conditions, "o.customer_id = "+arg(filter.CustomerID))
+	}
+	if filter.TrackNumber != "" {
+		conditions = append(conditions, "o.track_number = "+arg(filter.TrackNumber))
+	}
+	if filter.DeliveryService != "" {
+		conditions = append(conditions, "o.delivery_service = "+arg(filter.DeliveryService))
+	}
+	if filter.DateFrom != nil {
+		conditions = append(conditions, "o.date_created >= "+arg(*filter.DateFrom))
+	}
+	if filter.DateTo != nil {
+		conditions = append(conditions, "o.date_created < "+arg(*filter.DateTo))
+	}
+	if filter.Currency != "" {
+		conditions = append(conditions, "p.currency = "+arg(filter.Currency))
+	}
+	if filter.Provider != "" {
+		conditions = append(conditions, "p.provider = "+arg(filter.Provider))
+	}
+	if filter.Brand != "" {
+		conditions = append(conditions,
+			"EXISTS (SELECT 1 FROM items i WHERE i.order_id = o.id AND i.brand = "+arg(filter.Brand)+")")
+	}
+	if filter.NmID != 0 {
+		conditions = append(conditions,
+			"EXISTS (SELECT 1 FROM items i WHERE i.order_id = o.id AND i.nm_id = "+arg(filter.NmID)+")")
+	}
+	if filter.After != nil {
+		conditions = append(conditions,
+			fmt.Sprintf("(o.created_at, o.id) < (%s, %s)", arg(filter.After.CreatedAt), arg(filter.After.ID)))
+	}
+
+	query := orderSelectQuery + "\n\tWHERE " + strings.Join(conditions, " AND ")
+	query += "\n\tORDER BY o.created_at DESC, o.id DESC\n\tLIMIT " + arg(filter.Limit)
+
+	return queryOrders(ctx, db.DB, query, args...)
+}
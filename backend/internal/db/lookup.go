@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+
+	errors2 "github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// GetOrderByTrackNumber получает заказ по трек-номеру заказа или одной из его позиций.
+// Если трек-номер встречается в нескольких заказах, возвращается последний созданный
+func (db *Database) GetOrderByTrackNumber(ctx context.Context, trackNumber string) (*model.Order, error) {
+	return db.getOrderWhere(ctx, `o.id IN (
+		SELECT id FROM orders WHERE track_number = $1
+		UNION
+		SELECT order_id FROM items WHERE track_number = $1)`, trackNumber)
+}
+
+// GetOrderByTransaction получает заказ по идентификатору транзакции платежа
+func (db *Database) GetOrderByTransaction(ctx context.Context, transaction string) (*model.Order, error) {
+	return db.getOrderWhere(ctx, `o.id IN (SELECT order_id FROM payment WHERE transaction = $1)`, transaction)
+}
+
+// GetOrderByRID получает заказ по rid одной из его товарных позиций
+func (db *Database) GetOrderByRID(ctx context.Context, rid string) (*model.Order, error) {
+	return db.getOrderWhere(ctx, `o.id IN (SELECT order_id FROM items WHERE rid = $1)`, rid)
+}
+
+// getOrderWhere получает последний созданный неудаленный заказ, удовлетворяющий условию с одним параметром
+func (db *Database) getOrderWhere(ctx context.Context, condition string, value string) (*model.Order, error) {
+	query := orderSelectQuery + `
+	WHERE o.deleted_at IS NULL AND ` + condition + `
+	ORDER BY o.created_at DESC, o.id DESC
+	LIMIT 1`
+
+	orders, err := queryOrders(ctx, db.DB, query, value)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, errors2.NewNotFoundError("order")
+	}
+
+	return orders[0], nil
+}
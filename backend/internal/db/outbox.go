@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	errors2 "github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// outboxLockKey ключ advisory lock, который гарантирует, что outbox публикует только один relay,
+// иначе события одного заказа могли бы быть опубликованы не по порядку
+const outboxLockKey = 7_281_001
+
+// insertOutboxEvent записывает событие об изменении заказа в outbox в рамках транзакции заказа
+func insertOutboxEvent(ctx context.Context, tx *sql.Tx, eventType string, order *model.Order) error {
+	payload, err := json.Marshal(order)
+	if err != nil {
+		return errors2.NewDatabaseError("marshal outbox payload", err)
+	}
+
+	query := `INSERT INTO outbox (aggregate_id, event_type, payload) VALUES ($1, $2, $3)`
+
+	if _, err = tx.ExecContext(ctx, query, order.OrderUID, eventType, payload); err != nil {
+		return errors2.NewDatabaseError("insert outbox event", err)
+	}
+
+	return nil
+}
+
+// insertOutboxRows записывает события создания для заказов, созданных пакетом
+func insertOutboxRows(ctx context.Context, tx *sql.Tx, orders []*model.Order) error {
+	const columns = 3
+
+	for _, chunk := range chunkIndexes(len(orders), columns) {
+		args := make([]interface{}, 0, len(chunk)*columns)
+		for _, i := range chunk {
+			payload, err := json.Marshal(orders[i])
+			if err != nil {
+				return errors2.NewDatabaseError("marshal outbox payload", err)
+			}
+			args = append(args, orders[i].OrderUID, model.EventOrderCreated, payload)
+		}
+
+		query := fmt.Sprintf(`INSERT INTO outbox (aggregate_id, event_type, payload) VALUES %s`,
+			valuesPlaceholders(len(chunk), columns))
+
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return errors2.NewDatabaseError("insert outbox batch", err)
+		}
+	}
+
+	return nil
+}
+
+// RelayOutbox выбирает до limit неотправленных событий в порядке записи, передает их в publish
+// и помечает отправленными, если publish завершился без ошибки. Выполняется под advisory lock,
+// поэтому параллельные relay не публикуют события одновременно; возвращает количество
+// отправленных событий (0, если lock удерживается другим relay)
+func (db *Database) RelayOutbox(ctx context.Context, limit int, publish func([]model.OutboxEvent) error) (int, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors2.NewDatabaseError("begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err = tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, outboxLockKey).Scan(&locked); err != nil {
+		return 0, errors2.NewDatabaseError("acquire outbox lock", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	query := `
+		SELECT id, aggregate_id, event_type, payload, created_at
+		FROM outbox
+		WHERE sent_at IS NULL
+		ORDER BY id
+		LIMIT $1`
+
+	rows, err := tx.QueryContext(ctx, query, limit)
+	if err != nil {
+		return 0, errors2.NewDatabaseError("get outbox events", err)
+	}
+
+	var events []model.OutboxEvent
+	for rows.Next() {
+		var event model.OutboxEvent
+		if err = rows.Scan(&event.ID, &event.AggregateID, &event.EventType, &event.Payload, &event.CreatedAt); err != nil {
+			rows.Close()
+			return 0, errors2.NewDatabaseError("scan outbox event", err)
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return 0, errors2.NewDatabaseError("iterate outbox events", err)
+	}
+
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if err = publish(events); err != nil {
+		return 0, err
+	}
+
+	ids := make([]int64, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE outbox SET sent_at = CURRENT_TIMESTAMP WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+		return 0, errors2.NewDatabaseError("mark outbox events sent", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, errors2.NewDatabaseError("commit transaction", err)
+	}
+
+	return len(events), nil
+}
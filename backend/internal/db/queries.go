@@ -5,6 +5,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
+
+	"github.com/lib/pq"
 
 	errors2 "github.com/makhkets/wildberries-l0/internal/errors"
 	"github.com/makhkets/wildberries-l0/internal/model"
@@ -15,61 +18,90 @@ type Repo interface {
 	Close() error
 
 	GetOrderByUID(ctx context.Context, uid string) (*model.Order, error)
+	GetOrderByTrackNumber(ctx context.Context, trackNumber string) (*model.Order, error)
+	GetOrderByTransaction(ctx context.Context, transaction string) (*model.Order, error)
+	GetOrderByRID(ctx context.Context, rid string) (*model.Order, error)
 	CreateOrder(ctx context.Context, order *model.Order) error
+	CreateOrders(ctx context.Context, orders []*model.Order) []error
 	UpdateOrder(ctx context.Context, order *model.Order) error
-	DeleteOrder(ctx context.Context, uid string) error
+	DeleteOrder(ctx context.Context, uid, requestID string) error
+	ChangeStatus(ctx context.Context, current *model.Order, change model.StatusChange) (*model.Order, error)
 
 	OrderExists(ctx context.Context, uid string) (bool, error)
+	ArchiveOrders(ctx context.Context, olderThan time.Duration, limit int) ([]string, error)
+	IsMessageProcessed(ctx context.Context, source *model.MessageSource) (bool, error)
+	ListOrders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, error)
+	SearchOrders(ctx context.Context, text string, limit, offset int) ([]model.OrderSummary, error)
+	GetOrderHistory(ctx context.Context, uid string, limit int) ([]model.OrderHistoryEntry, error)
+	RelayOutbox(ctx context.Context, limit int, publish func([]model.OutboxEvent) error) (int, error)
 	GetCacheOrders(ctx context.Context, ordersCount int) ([]*model.Order, error)
 }
 
+// querier общий интерфейс *sql.DB и *sql.Tx для запросов на чтение
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 // GetOrderByUID получает заказ по UID из базы данных одним запросом с JOIN
 func (db *Database) GetOrderByUID(ctx context.Context, uid string) (*model.Order, error) {
-	// сначала получаем основную информацию о заказе, доставке и платеже одним запросом
-	mainQuery := `
-		SELECT 
-			o.id, o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
-			o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created,
-			o.oof_shard, o.created_at, o.updated_at,
-			
-			COALESCE(d.id, 0) as delivery_id,
-			COALESCE(d.order_id, 0) as delivery_order_id, 
-			COALESCE(d.name, '') as delivery_name,
-			COALESCE(d.phone, '') as delivery_phone,
-			COALESCE(d.zip, '') as delivery_zip,
-			COALESCE(d.city, '') as delivery_city,
-			COALESCE(d.address, '') as delivery_address,
-			COALESCE(d.region, '') as delivery_region,
-			COALESCE(d.email, '') as delivery_email,
-			
-			COALESCE(p.id, 0) as payment_id,
-			COALESCE(p.order_id, 0) as payment_order_id,
-			COALESCE(p.transaction, '') as payment_transaction,
-			COALESCE(p.request_id, '') as payment_request_id,
-			COALESCE(p.currency, '') as payment_currency,
-			COALESCE(p.provider, '') as payment_provider,
-			COALESCE(p.amount, 0) as payment_amount,
-			COALESCE(p.payment_dt, 0) as payment_dt,
-			COALESCE(p.bank, '') as payment_bank,
-			COALESCE(p.delivery_cost, 0) as payment_delivery_cost,
-			COALESCE(p.goods_total, 0) as payment_goods_total,
-			COALESCE(p.custom_fee, 0) as payment_custom_fee
-		FROM orders o
-		LEFT JOIN delivery d ON o.id = d.order_id
-		LEFT JOIN payment p ON o.id = p.order_id
-		WHERE o.order_uid = $1`
+	return getOrderByUID(ctx, db.DB, uid)
+}
+
+// getOrderByUID читает заказ со всеми связанными данными через q (подключение или транзакцию)
+func getOrderByUID(ctx context.Context, q querier, uid string) (*model.Order, error) {
+	query := orderSelectQuery + `
+	WHERE o.order_uid = $1 AND o.deleted_at IS NULL`
+
+	orders, err := queryOrders(ctx, q, query, uid)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, errors2.NewNotFoundError("order")
+	}
+
+	return orders[0], nil
+}
+
+// orderSelectQuery выборка заказов вместе с доставкой и платежом, к которой добавляются условия
+const orderSelectQuery = `
+	SELECT 
+		o.id, o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
+		o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created,
+		o.oof_shard, o.created_at, o.updated_at, o.version, o.status,
+
+		COALESCE(d.id, 0), COALESCE(d.order_id, 0), COALESCE(d.name, ''),
+		COALESCE(d.phone, ''), COALESCE(d.zip, ''), COALESCE(d.city, ''),
+		COALESCE(d.address, ''), COALESCE(d.region, ''), COALESCE(d.email, ''),
+
+		COALESCE(p.id, 0), COALESCE(p.order_id, 0), COALESCE(p.transaction, ''),
+		COALESCE(p.request_id, ''), COALESCE(p.currency, ''), COALESCE(p.provider, ''),
+		COALESCE(p.amount, 0), COALESCE(p.payment_dt, 0), COALESCE(p.bank, ''),
+		COALESCE(p.delivery_cost, 0), COALESCE(p.goods_total, 0), COALESCE(p.custom_fee, 0),
+		COALESCE(p.status, 0)
+	FROM orders o
+	LEFT JOIN delivery d ON o.id = d.order_id
+	LEFT JOIN payment p ON o.id = p.order_id`
+
+// rowScanner общий интерфейс *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
+// scanOrder читает строку orderSelectQuery
+func scanOrder(row rowScanner) (*model.Order, error) {
 	order := &model.Order{
 		Delivery: &model.Delivery{},
 		Payment:  &model.Payment{},
 		Items:    []model.Item{},
 	}
 
-	err := db.DB.QueryRowContext(ctx, mainQuery, uid).Scan(
+	err := row.Scan(
 		&order.ID, &order.OrderUID, &order.TrackNumber, &order.Entry,
 		&order.Locale, &order.InternalSignature, &order.CustomerID,
 		&order.DeliveryService, &order.Shardkey, &order.SmID,
-		&order.DateCreated, &order.OofShard, &order.CreatedAt, &order.UpdatedAt,
+		&order.DateCreated, &order.OofShard, &order.CreatedAt, &order.UpdatedAt, &order.Version, &order.Status,
 
 		&order.Delivery.ID, &order.Delivery.OrderID, &order.Delivery.Name,
 		&order.Delivery.Phone, &order.Delivery.Zip, &order.Delivery.City,
@@ -79,29 +111,69 @@ func (db *Database) GetOrderByUID(ctx context.Context, uid string) (*model.Order
 		&order.Payment.RequestID, &order.Payment.Currency, &order.Payment.Provider,
 		&order.Payment.Amount, &order.Payment.PaymentDt, &order.Payment.Bank,
 		&order.Payment.DeliveryCost, &order.Payment.GoodsTotal, &order.Payment.CustomFee,
+		&order.Payment.Status,
 	)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors2.NewNotFoundError("order")
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// queryOrders выполняет запрос на основе orderSelectQuery и загружает товары найденных заказов
+func queryOrders(ctx context.Context, q querier, query string, args ...interface{}) ([]*model.Order, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors2.NewDatabaseError("get orders", err)
+	}
+	defer rows.Close()
+
+	orders := make([]*model.Order, 0)
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, errors2.NewDatabaseError("scan order", err)
 		}
-		return nil, errors2.NewDatabaseError("get order", err)
+		orders = append(orders, order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors2.NewDatabaseError("iterate orders", err)
+	}
+
+	if err = attachItems(ctx, q, orders); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+// attachItems загружает товарные позиции для заказов одним запросом
+func attachItems(ctx context.Context, q querier, orders []*model.Order) error {
+	if len(orders) == 0 {
+		return nil
 	}
 
-	// Получаем товарные позиции отдельным запросом (так как их может быть много)
-	itemsQuery := `
+	byID := make(map[int]*model.Order, len(orders))
+	ids := make([]int64, len(orders))
+	for i, order := range orders {
+		byID[order.ID] = order
+		ids[i] = int64(order.ID)
+	}
+
+	query := `
 		SELECT id, order_id, chrt_id, track_number, price, rid, name,
 		       sale, size, total_price, nm_id, brand, status
-		FROM items 
-		WHERE order_id = $1
-		ORDER BY id`
+		FROM items
+		WHERE order_id = ANY($1)
+		ORDER BY order_id, id`
 
-	rows, err := db.DB.QueryContext(ctx, itemsQuery, order.ID)
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids))
 	if err != nil {
-		return nil, errors2.NewDatabaseError("get order items", err)
+		return errors2.NewDatabaseError("get order items", err)
 	}
 	defer rows.Close()
 
-	var items []model.Item
 	for rows.Next() {
 		var item model.Item
 		err = rows.Scan(
@@ -110,27 +182,32 @@ func (db *Database) GetOrderByUID(ctx context.Context, uid string) (*model.Order
 			&item.TotalPrice, &item.NmID, &item.Brand, &item.Status,
 		)
 		if err != nil {
-			return nil, errors2.NewDatabaseError("scan order item", err)
+			return errors2.NewDatabaseError("scan order item", err)
+		}
+
+		if order, ok := byID[item.OrderID]; ok {
+			order.Items = append(order.Items, item)
 		}
-		items = append(items, item)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, errors2.NewDatabaseError("iterate order items", err)
+		return errors2.NewDatabaseError("iterate order items", err)
 	}
 
-	order.Items = items
-	return order, nil
+	return nil
 }
 
 // CreateOrder создает новый заказ в базе данных
 func (db *Database) CreateOrder(ctx context.Context, order *model.Order) error {
-	// Проверяем, что заказ с таким UID не существует
-	exists, err := db.OrderExists(ctx, order.OrderUID)
+	// Проверяем, что UID не занят ни существующим, ни удаленным заказом
+	taken, deleted, err := uidTaken(ctx, db.DB, order.OrderUID)
 	if err != nil {
 		return errors2.NewDatabaseError("check order existence", err)
 	}
-	if exists {
+	if deleted {
+		return errors2.NewDeletedOrderConflictError()
+	}
+	if taken {
 		return errors2.NewConflictError("order")
 	}
 
@@ -140,18 +217,23 @@ func (db *Database) CreateOrder(ctx context.Context, order *model.Order) error {
 	}
 	defer tx.Rollback()
 
+	// Записываем исходное сообщение в журнал в той же транзакции
+	if err = recordMessage(ctx, tx, order); err != nil {
+		return err
+	}
+
 	// Создаем основной заказ
 	orderQuery := `
 		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature,
 		                   customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		RETURNING id, created_at, updated_at`
+		RETURNING id, created_at, updated_at, version, status`
 
 	err = tx.QueryRowContext(ctx, orderQuery,
 		order.OrderUID, order.TrackNumber, order.Entry, order.Locale,
 		order.InternalSignature, order.CustomerID, order.DeliveryService,
 		order.Shardkey, order.SmID, order.DateCreated, order.OofShard,
-	).Scan(&order.ID, &order.CreatedAt, &order.UpdatedAt)
+	).Scan(&order.ID, &order.CreatedAt, &order.UpdatedAt, &order.Version, &order.Status)
 	if err != nil {
 		return errors2.NewDatabaseError("insert order", err)
 	}
@@ -180,14 +262,14 @@ func (db *Database) CreateOrder(ctx context.Context, order *model.Order) error {
 			INSERT INTO payment (order_id, transaction, request_id, currency, provider,
 			                    amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
 			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-			RETURNING id`
+			RETURNING id, status`
 
 		err = tx.QueryRowContext(ctx, paymentQuery,
 			order.ID, order.Payment.Transaction, order.Payment.RequestID,
 			order.Payment.Currency, order.Payment.Provider, order.Payment.Amount,
 			order.Payment.PaymentDt, order.Payment.Bank, order.Payment.DeliveryCost,
 			order.Payment.GoodsTotal, order.Payment.CustomFee,
-		).Scan(&order.Payment.ID)
+		).Scan(&order.Payment.ID, &order.Payment.Status)
 		if err != nil {
 			return errors2.NewDatabaseError("insert payment", err)
 		}
@@ -214,6 +296,16 @@ func (db *Database) CreateOrder(ctx context.Context, order *model.Order) error {
 		order.Items[i].OrderID = order.ID
 	}
 
+	// Снимок заказа в историю изменений
+	if err = insertHistoryEntry(ctx, tx, model.EventOrderCreated, order); err != nil {
+		return err
+	}
+
+	// Событие о создании заказа публикуется relay'ем из outbox
+	if err = insertOutboxEvent(ctx, tx, model.EventOrderCreated, order); err != nil {
+		return err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return errors2.NewDatabaseError("commit transaction", err)
 	}
@@ -221,222 +313,178 @@ func (db *Database) CreateOrder(ctx context.Context, order *model.Order) error {
 	return nil
 }
 
-// UpdateOrder обновляет существующий заказ
+// UpdateOrder обновляет заказ целиком в одной транзакции: строку orders, доставку, платеж
+// и товарные позиции (по chrt_id). Обновление выполняется, только если версия заказа в базе
+// совпадает с order.Version, иначе возвращается VersionConflictError.
+// После записи заказ перечитывается из базы, и order заполняется сохраненными данными
 func (db *Database) UpdateOrder(ctx context.Context, order *model.Order) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return errors2.NewDatabaseError("begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	// Записываем исходное сообщение в журнал в той же транзакции
+	if err = recordMessage(ctx, tx, order); err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE orders 
 		SET track_number = $2, entry = $3, locale = $4, internal_signature = $5,
 		    customer_id = $6, delivery_service = $7, shardkey = $8, sm_id = $9,
-		    date_created = $10, oof_shard = $11
-		WHERE order_uid = $1`
+		    date_created = $10, oof_shard = $11, version = version + 1
+		WHERE order_uid = $1 AND version = $12 AND deleted_at IS NULL
+		RETURNING id`
 
-	result, err := db.DB.ExecContext(ctx, query,
+	var orderID int
+	err = tx.QueryRowContext(ctx, query,
 		order.OrderUID, order.TrackNumber, order.Entry, order.Locale,
 		order.InternalSignature, order.CustomerID, order.DeliveryService,
 		order.Shardkey, order.SmID, order.DateCreated, order.OofShard,
-	)
+		order.Version,
+	).Scan(&orderID)
 	if err != nil {
-		return fmt.Errorf("failed to update order: %w", err)
-	}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return errors2.NewDatabaseError("update order", err)
+		}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return versionMismatch(ctx, tx, order.OrderUID)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("order with UID %s not found", order.OrderUID)
+	if err = upsertDelivery(ctx, tx, orderID, order.Delivery); err != nil {
+		return err
 	}
 
-	return nil
-}
+	if err = upsertPayment(ctx, tx, orderID, order.Payment); err != nil {
+		return err
+	}
 
-// DeleteOrder удаляет заказ по UID
-func (db *Database) DeleteOrder(ctx context.Context, uid string) error {
-	query := `DELETE FROM orders WHERE order_uid = $1`
+	if err = syncItems(ctx, tx, orderID, order.Items); err != nil {
+		return err
+	}
 
-	result, err := db.DB.ExecContext(ctx, query, uid)
+	// Перечитываем заказ, чтобы вернуть (и закэшировать) ровно то, что сохранено
+	stored, err := getOrderByUID(ctx, tx, order.OrderUID)
 	if err != nil {
-		return fmt.Errorf("failed to delete order: %w", err)
+		return err
 	}
+	stored.Source = order.Source
+	stored.RequestID = order.RequestID
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+	// Снимок заказа в историю изменений
+	if err = insertHistoryEntry(ctx, tx, model.EventOrderUpdated, stored); err != nil {
+		return err
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("order with UID %s not found", uid)
+	// Событие об изменении заказа публикуется relay'ем из outbox
+	if err = insertOutboxEvent(ctx, tx, model.EventOrderUpdated, stored); err != nil {
+		return err
 	}
 
+	if err = tx.Commit(); err != nil {
+		return errors2.NewDatabaseError("commit transaction", err)
+	}
+
+	*order = *stored
 	return nil
 }
 
-// OrderExists проверяет существование заказа по UID
-func (db *Database) OrderExists(ctx context.Context, uid string) (bool, error) {
-	query := `SELECT 1 FROM orders WHERE order_uid = $1`
-
+// versionMismatch определяет, почему условное обновление заказа не затронуло строку:
+// заказа нет (NotFoundError) либо его версия уже изменилась (VersionConflictError)
+func versionMismatch(ctx context.Context, tx *sql.Tx, uid string) error {
 	var exists int
-	err := db.DB.QueryRowContext(ctx, query, uid).Scan(&exists)
+	err := tx.QueryRowContext(ctx, `SELECT 1 FROM orders WHERE order_uid = $1 AND deleted_at IS NULL`, uid).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors2.NewNotFoundError("order")
+	}
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return false, nil
-		}
-		return false, fmt.Errorf("failed to check order existence: %w", err)
+		return errors2.NewDatabaseError("check order existence", err)
 	}
-
-	return true, nil
+	return errors2.NewVersionConflictError("order")
 }
 
-// GetCacheOrders получает последние N ордеров из базы со всеми связанными данными
-func (db *Database) GetCacheOrders(ctx context.Context, ordersCount int) ([]*model.Order, error) {
-	// Получаем основные данные заказов с delivery и payment
-	mainQuery := `
-		SELECT 
-			o.id, o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
-			o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created,
-			o.oof_shard, o.created_at, o.updated_at,
-			
-			COALESCE(d.id, 0) as delivery_id,
-			COALESCE(d.order_id, 0) as delivery_order_id, 
-			COALESCE(d.name, '') as delivery_name,
-			COALESCE(d.phone, '') as delivery_phone,
-			COALESCE(d.zip, '') as delivery_zip,
-			COALESCE(d.city, '') as delivery_city,
-			COALESCE(d.address, '') as delivery_address,
-			COALESCE(d.region, '') as delivery_region,
-			COALESCE(d.email, '') as delivery_email,
-			
-			COALESCE(p.id, 0) as payment_id,
-			COALESCE(p.order_id, 0) as payment_order_id,
-			COALESCE(p.transaction, '') as payment_transaction,
-			COALESCE(p.request_id, '') as payment_request_id,
-			COALESCE(p.currency, '') as payment_currency,
-			COALESCE(p.provider, '') as payment_provider,
-			COALESCE(p.amount, 0) as payment_amount,
-			COALESCE(p.payment_dt, 0) as payment_dt,
-			COALESCE(p.bank, '') as payment_bank,
-			COALESCE(p.delivery_cost, 0) as payment_delivery_cost,
-			COALESCE(p.goods_total, 0) as payment_goods_total,
-			COALESCE(p.custom_fee, 0) as payment_custom_fee
-		FROM orders o
-		LEFT JOIN delivery d ON o.id = d.order_id
-		LEFT JOIN payment p ON o.id = p.order_id
-		ORDER BY o.created_at DESC
-		LIMIT $1`
-
-	rows, err := db.DB.QueryContext(ctx, mainQuery, ordersCount)
+// DeleteOrder мягко удаляет заказ по UID: заказ помечается deleted_at и перестает возвращаться
+// при чтении, а окончательно удаляется при архивации. Снимок удаленного заказа
+// записывается в историю изменений, событие об удалении - в outbox
+func (db *Database) DeleteOrder(ctx context.Context, uid, requestID string) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, errors2.NewDatabaseError("get cache orders", err)
+		return errors2.NewDatabaseError("begin transaction", err)
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var orders []*model.Order
-	orderMap := make(map[int]*model.Order) // для быстрого поиска заказов по ID
+	order, err := getOrderByUID(ctx, tx, uid)
+	if err != nil {
+		return err
+	}
+	order.RequestID = requestID
 
-	for rows.Next() {
-		order := &model.Order{
-			Delivery: &model.Delivery{},
-			Payment:  &model.Payment{},
-			Items:    []model.Item{},
-		}
+	query := `
+		UPDATE orders
+		SET deleted_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING version`
 
-		err = rows.Scan(
-			&order.ID, &order.OrderUID, &order.TrackNumber, &order.Entry,
-			&order.Locale, &order.InternalSignature, &order.CustomerID,
-			&order.DeliveryService, &order.Shardkey, &order.SmID,
-			&order.DateCreated, &order.OofShard, &order.CreatedAt, &order.UpdatedAt,
-
-			&order.Delivery.ID, &order.Delivery.OrderID, &order.Delivery.Name,
-			&order.Delivery.Phone, &order.Delivery.Zip, &order.Delivery.City,
-			&order.Delivery.Address, &order.Delivery.Region, &order.Delivery.Email,
-
-			&order.Payment.ID, &order.Payment.OrderID, &order.Payment.Transaction,
-			&order.Payment.RequestID, &order.Payment.Currency, &order.Payment.Provider,
-			&order.Payment.Amount, &order.Payment.PaymentDt, &order.Payment.Bank,
-			&order.Payment.DeliveryCost, &order.Payment.GoodsTotal, &order.Payment.CustomFee,
-		)
-		if err != nil {
-			return nil, errors2.NewDatabaseError("scan cache order", err)
+	if err = tx.QueryRowContext(ctx, query, order.ID).Scan(&order.Version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors2.NewNotFoundError("order")
 		}
-
-		orders = append(orders, order)
-		orderMap[order.ID] = order
+		return errors2.NewDatabaseError("delete order", err)
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, errors2.NewDatabaseError("iterate cache orders", err)
+	if err = insertHistoryEntry(ctx, tx, model.EventOrderDeleted, order); err != nil {
+		return err
 	}
 
-	// Если заказов нет, возвращаем пустой slice
-	if len(orders) == 0 {
-		return orders, nil
+	if err = insertOutboxEvent(ctx, tx, model.EventOrderDeleted, order); err != nil {
+		return err
 	}
 
-	// Получаем все order_id для загрузки items
-	orderIDs := make([]interface{}, len(orders))
-	placeholders := make([]string, len(orders))
-	for i, order := range orders {
-		orderIDs[i] = order.ID
-		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	if err = tx.Commit(); err != nil {
+		return errors2.NewDatabaseError("commit transaction", err)
 	}
 
-	// Загружаем все items для всех заказов одним запросом
-	itemsQuery := fmt.Sprintf(`
-		SELECT id, order_id, chrt_id, track_number, price, rid, name,
-		       sale, size, total_price, nm_id, brand, status
-		FROM items 
-		WHERE order_id IN (%s)
-		ORDER BY order_id, id`, fmt.Sprintf("%s", fmt.Sprintf("%s", placeholders[0])))
+	return nil
+}
 
-	// Исправляем построение плейсхолдеров
-	itemsQuery = fmt.Sprintf(`
-		SELECT id, order_id, chrt_id, track_number, price, rid, name,
-		       sale, size, total_price, nm_id, brand, status
-		FROM items 
-		WHERE order_id IN (%s)
-		ORDER BY order_id, id`, joinPlaceholders(placeholders, ","))
+// OrderExists проверяет существование заказа по UID. Удаленные заказы не учитываются
+func (db *Database) OrderExists(ctx context.Context, uid string) (bool, error) {
+	query := `SELECT 1 FROM orders WHERE order_uid = $1 AND deleted_at IS NULL`
 
-	itemRows, err := db.DB.QueryContext(ctx, itemsQuery, orderIDs...)
+	var exists int
+	err := db.DB.QueryRowContext(ctx, query, uid).Scan(&exists)
 	if err != nil {
-		return nil, errors2.NewDatabaseError("get cache order items", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check order existence: %w", err)
 	}
-	defer itemRows.Close()
 
-	// Группируем items по order_id
-	for itemRows.Next() {
-		var item model.Item
-		err = itemRows.Scan(
-			&item.ID, &item.OrderID, &item.ChrtID, &item.TrackNumber,
-			&item.Price, &item.RID, &item.Name, &item.Sale, &item.Size,
-			&item.TotalPrice, &item.NmID, &item.Brand, &item.Status,
-		)
-		if err != nil {
-			return nil, errors2.NewDatabaseError("scan cache order item", err)
-		}
+	return true, nil
+}
 
-		// Находим соответствующий заказ и добавляем к нему item
-		if order, exists := orderMap[item.OrderID]; exists {
-			order.Items = append(order.Items, item)
-		}
+// uidTaken проверяет, занят ли UID заказом (taken), в том числе удаленным (deleted):
+// UID удаленного заказа остается занятым до архивации, поэтому создать заказ с ним нельзя
+func uidTaken(ctx context.Context, q querier, uid string) (taken, deleted bool, err error) {
+	var deletedAt sql.NullTime
+	err = q.QueryRowContext(ctx, `SELECT deleted_at FROM orders WHERE order_uid = $1`, uid).Scan(&deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, false, nil
 	}
-
-	if err = itemRows.Err(); err != nil {
-		return nil, errors2.NewDatabaseError("iterate cache order items", err)
+	if err != nil {
+		return false, false, err
 	}
 
-	return orders, nil
+	return true, deletedAt.Valid, nil
 }
 
-// joinPlaceholders соединяет плейсхолдеры строкой-разделителем
-func joinPlaceholders(placeholders []string, separator string) string {
-	if len(placeholders) == 0 {
-		return ""
-	}
+// GetCacheOrders получает последние N ордеров из базы со всеми связанными данными
+func (db *Database) GetCacheOrders(ctx context.Context, ordersCount int) ([]*model.Order, error) {
+	query := orderSelectQuery + `
+	WHERE o.deleted_at IS NULL
+	ORDER BY o.created_at DESC
+	LIMIT $1`
 
-	result := placeholders[0]
-	for i := 1; i < len(placeholders); i++ {
-		result += separator + placeholders[i]
-	}
-	return result
+	return queryOrders(ctx, db.DB, query, ordersCount)
 }
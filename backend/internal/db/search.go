@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"strings"
+
+	errors2 "github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// highlightStart маркер начала совпадения во фрагментах ts_headline
+const highlightStart = "<mark>"
+
+// SearchOrders ищет заказы по данным доставки, названиям и брендам товаров: полнотекстово
+// (tsvector) и нечетко (триграммы). Возвращает до limit заказов, начиная с offset,
+// в порядке убывания релевантности
+func (db *Database) SearchOrders(ctx context.Context, text string, limit, offset int) ([]model.OrderSummary, error) {
+	query := `
+		WITH q AS (
+			SELECT websearch_to_tsquery('simple', $1) AS tsq
+		),
+		matches AS (
+			SELECT d.order_id,
+			       ts_rank(d.search_vector, q.tsq) +
+			       word_similarity($1, d.name || ' ' || d.city || ' ' || d.address || ' ' || d.email) AS rank
+			FROM delivery d
+			JOIN orders o ON o.id = d.order_id AND o.deleted_at IS NULL
+			CROSS JOIN q
+			WHERE (d.search_vector @@ q.tsq
+			   OR $1 <% (d.name || ' ' || d.city || ' ' || d.address || ' ' || d.email))
+
+			UNION ALL
+
+			SELECT i.order_id,
+			       ts_rank(i.search_vector, q.tsq) + word_similarity($1, i.name || ' ' || i.brand) AS rank
+			FROM items i
+			JOIN orders o ON o.id = i.order_id AND o.deleted_at IS NULL
+			CROSS JOIN q
+			WHERE (i.search_vector @@ q.tsq
+			   OR $1 <% (i.name || ' ' || i.brand))
+		),
+		ranked AS (
+			SELECT order_id, max(rank) AS rank
+			FROM matches
+			GROUP BY order_id
+			ORDER BY rank DESC, order_id DESC
+			LIMIT $2 OFFSET $3
+		)
+		SELECT o.order_uid, o.track_number, o.customer_id,
+		       COALESCE(d.name, ''), COALESCE(d.city, ''), o.date_created,
+		       COALESCE(p.amount, 0), COALESCE(p.currency, ''),
+		       (SELECT count(*) FROM items i WHERE i.order_id = o.id),
+		       r.rank,
+		       COALESCE(ts_headline('simple', d.name || ' ' || d.city || ' ' || d.address || ' ' || d.email,
+		                            q.tsq, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2'), ''),
+		       COALESCE((SELECT ts_headline('simple', string_agg(i.name || ' ' || i.brand, '; ' ORDER BY i.id),
+		                                    q.tsq, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2')
+		                 FROM items i WHERE i.order_id = o.id), '')
+		FROM ranked r
+		JOIN orders o ON o.id = r.order_id
+		LEFT JOIN delivery d ON d.order_id = o.id
+		LEFT JOIN payment p ON p.order_id = o.id
+		CROSS JOIN q
+		ORDER BY r.rank DESC, o.id DESC`
+
+	rows, err := db.DB.QueryContext(ctx, query, text, limit, offset)
+	if err != nil {
+		return nil, errors2.NewDatabaseError("search orders", err)
+	}
+	defer rows.Close()
+
+	results := make([]model.OrderSummary, 0)
+	for rows.Next() {
+		var (
+			summary           model.OrderSummary
+			deliveryHighlight string
+			itemsHighlight    string
+		)
+
+		err = rows.Scan(
+			&summary.OrderUID, &summary.TrackNumber, &summary.CustomerID,
+			&summary.CustomerName, &summary.City, &summary.DateCreated,
+			&summary.Amount, &summary.Currency, &summary.ItemsCount,
+			&summary.Rank, &deliveryHighlight, &itemsHighlight,
+		)
+		if err != nil {
+			return nil, errors2.NewDatabaseError("scan search result", err)
+		}
+
+		// ts_headline возвращает начало текста, даже если совпадение найдено только по триграммам
+		for _, highlight := range []string{deliveryHighlight, itemsHighlight} {
+			if strings.Contains(highlight, highlightStart) {
+				summary.Highlights = append(summary.Highlights, highlight)
+			}
+		}
+
+		results = append(results, summary)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors2.NewDatabaseError("iterate search results", err)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	errors2 "github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// ChangeStatus изменяет статусы заказа и платежа, если версия заказа в базе совпадает
+// с current.Version, и записывает переходы в журнал. current содержит исходные статусы.
+// Возвращает заказ, перечитанный из базы после изменения
+func (db *Database) ChangeStatus(ctx context.Context, current *model.Order, change model.StatusChange) (*model.Order, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors2.NewDatabaseError("begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	status := current.Status
+	if change.OrderStatus != nil {
+		status = *change.OrderStatus
+	}
+
+	query := `
+		UPDATE orders
+		SET status = $2, version = version + 1
+		WHERE order_uid = $1 AND version = $3 AND deleted_at IS NULL
+		RETURNING id`
+
+	var orderID int
+	if err = tx.QueryRowContext(ctx, query, current.OrderUID, status, current.Version).Scan(&orderID); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, errors2.NewDatabaseError("update order status", err)
+		}
+		return nil, versionMismatch(ctx, tx, current.OrderUID)
+	}
+
+	if change.OrderStatus != nil {
+		err = insertStatusTransition(ctx, tx, current.OrderUID, model.StatusEntityOrder,
+			int(current.Status), int(*change.OrderStatus), change.RequestID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if change.PaymentStatus != nil {
+		if _, err = tx.ExecContext(ctx, `UPDATE payment SET status = $2 WHERE order_id = $1`, orderID, *change.PaymentStatus); err != nil {
+			return nil, errors2.NewDatabaseError("update payment status", err)
+		}
+
+		err = insertStatusTransition(ctx, tx, current.OrderUID, model.StatusEntityPayment,
+			int(current.Payment.Status), int(*change.PaymentStatus), change.RequestID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stored, err := getOrderByUID(ctx, tx, current.OrderUID)
+	if err != nil {
+		return nil, err
+	}
+	stored.RequestID = change.RequestID
+
+	if err = insertHistoryEntry(ctx, tx, model.EventOrderStatusChanged, stored); err != nil {
+		return nil, err
+	}
+
+	if err = insertOutboxEvent(ctx, tx, model.EventOrderStatusChanged, stored); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, errors2.NewDatabaseError("commit transaction", err)
+	}
+
+	return stored, nil
+}
+
+// insertStatusTransition записывает переход статуса в журнал
+func insertStatusTransition(ctx context.Context, tx *sql.Tx, uid, entity string, from, to int, requestID string) error {
+	query := `
+		INSERT INTO status_transitions (order_uid, entity, from_status, to_status, request_id)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := tx.ExecContext(ctx, query, uid, entity, from, to, sql.NullString{String: requestID, Valid: requestID != ""})
+	if err != nil {
+		return errors2.NewDatabaseError("insert status transition", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	errors2 "github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// upsertDelivery создает или обновляет данные доставки заказа; пустая доставка удаляется
+func upsertDelivery(ctx context.Context, tx *sql.Tx, orderID int, delivery *model.Delivery) error {
+	if delivery == nil || delivery.Name == "" {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM delivery WHERE order_id = $1`, orderID); err != nil {
+			return errors2.NewDatabaseError("delete delivery", err)
+		}
+		return nil
+	}
+
+	query := `
+		INSERT INTO delivery (order_id, name, phone, zip, city, address, region, email)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (order_id) DO UPDATE
+		SET name = EXCLUDED.name, phone = EXCLUDED.phone, zip = EXCLUDED.zip,
+		    city = EXCLUDED.city, address = EXCLUDED.address, region = EXCLUDED.region,
+		    email = EXCLUDED.email`
+
+	_, err := tx.ExecContext(ctx, query,
+		orderID, delivery.Name, delivery.Phone, delivery.Zip, delivery.City,
+		delivery.Address, delivery.Region, delivery.Email,
+	)
+	if err != nil {
+		return errors2.NewDatabaseError("upsert delivery", err)
+	}
+
+	return nil
+}
+
+// upsertPayment создает или обновляет данные платежа заказа; пустой платеж удаляется
+func upsertPayment(ctx context.Context, tx *sql.Tx, orderID int, payment *model.Payment) error {
+	if payment == nil || payment.Transaction == "" {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM payment WHERE order_id = $1`, orderID); err != nil {
+			return errors2.NewDatabaseError("delete payment", err)
+		}
+		return nil
+	}
+
+	query := `
+		INSERT INTO payment (order_id, transaction, request_id, currency, provider,
+		                    amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (order_id) DO UPDATE
+		SET transaction = EXCLUDED.transaction, request_id = EXCLUDED.request_id,
+		    currency = EXCLUDED.currency, provider = EXCLUDED.provider, amount = EXCLUDED.amount,
+		    payment_dt = EXCLUDED.payment_dt, bank = EXCLUDED.bank,
+		    delivery_cost = EXCLUDED.delivery_cost, goods_total = EXCLUDED.goods_total,
+		    custom_fee = EXCLUDED.custom_fee`
+
+	_, err := tx.ExecContext(ctx, query,
+		orderID, payment.Transaction, payment.RequestID, payment.Currency, payment.Provider,
+		payment.Amount, payment.PaymentDt, payment.Bank, payment.DeliveryCost,
+		payment.GoodsTotal, payment.CustomFee,
+	)
+	if err != nil {
+		return errors2.NewDatabaseError("upsert payment", err)
+	}
+
+	return nil
+}
+
+// syncItems приводит товарные позиции заказа к items: позиции с совпадающим chrt_id обновляются,
+// новые добавляются, отсутствующие в items удаляются. Повторяющиеся chrt_id сопоставляются по порядку
+func syncItems(ctx context.Context, tx *sql.Tx, orderID int, items []model.Item) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id, chrt_id FROM items WHERE order_id = $1 ORDER BY id`, orderID)
+	if err != nil {
+		return errors2.NewDatabaseError("get order items", err)
+	}
+
+	existing := make(map[int][]int)
+	for rows.Next() {
+		var id, chrtID int
+		if err = rows.Scan(&id, &chrtID); err != nil {
+			rows.Close()
+			return errors2.NewDatabaseError("scan order item", err)
+		}
+		existing[chrtID] = append(existing[chrtID], id)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return errors2.NewDatabaseError("iterate order items", err)
+	}
+
+	updateQuery := `
+		UPDATE items
+		SET track_number = $2, price = $3, rid = $4, name = $5, sale = $6,
+		    size = $7, total_price = $8, nm_id = $9, brand = $10, status = $11
+		WHERE id = $1`
+
+	insertQuery := `
+		INSERT INTO items (order_id, chrt_id, track_number, price, rid, name,
+		                  sale, size, total_price, nm_id, brand, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+	for i, item := range items {
+		if ids := existing[item.ChrtID]; len(ids) > 0 {
+			existing[item.ChrtID] = ids[1:]
+
+			_, err = tx.ExecContext(ctx, updateQuery,
+				ids[0], item.TrackNumber, item.Price, item.RID, item.Name, item.Sale,
+				item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status,
+			)
+			if err != nil {
+				return errors2.NewDatabaseError(fmt.Sprintf("update item %d", i), err)
+			}
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, insertQuery,
+			orderID, item.ChrtID, item.TrackNumber, item.Price, item.RID, item.Name,
+			item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status,
+		)
+		if err != nil {
+			return errors2.NewDatabaseError(fmt.Sprintf("insert item %d", i), err)
+		}
+	}
+
+	// Удаляем позиции, которых нет в новом составе заказа
+	var stale []int64
+	for _, ids := range existing {
+		for _, id := range ids {
+			stale = append(stale, int64(id))
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM items WHERE id = ANY($1)`, pq.Array(stale)); err != nil {
+		return errors2.NewDatabaseError("delete stale items", err)
+	}
+
+	return nil
+}
@@ -20,6 +20,14 @@ var (
 	ErrForbidden    = errors.New("forbidden")
 	ErrConflict     = errors.New("conflict")
 
+	// Concurrency errors
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrOrderDeleted UID принадлежит удаленному, но еще не архивированному заказу
+	ErrOrderDeleted = errors.New("order deleted")
+
+	// Messaging errors
+	ErrDuplicateMessage = errors.New("message already processed")
+
 	// External service errors
 	ErrExternalAPI = errors.New("external api error")
 	ErrTimeout     = errors.New("timeout error")
@@ -30,6 +38,7 @@ type AppError struct {
 	Type       ErrorType `json:"type"`
 	Message    string    `json:"message"`
 	Details    string    `json:"details,omitempty"`
+	Field      string    `json:"field,omitempty"`
 	StatusCode int       `json:"-"`
 	Internal   error     `json:"-"`
 }
@@ -118,7 +127,9 @@ func NewNotFoundError(resource string) *AppError {
 }
 
 func NewValidationError(field, reason string) *AppError {
-	return NewAppErrorWithDetails(ErrorTypeValidation, "Validation failed", fmt.Sprintf("Field '%s': %s", field, reason))
+	appErr := NewAppErrorWithDetails(ErrorTypeValidation, "Validation failed", fmt.Sprintf("Field '%s': %s", field, reason))
+	appErr.Field = field
+	return appErr
 }
 
 func NewDatabaseError(operation string, internal error) *AppError {
@@ -138,6 +149,32 @@ func NewConflictError(resource string) *AppError {
 	return NewAppError(ErrorTypeConflict, fmt.Sprintf("%s already exists", resource))
 }
 
+// NewDuplicateMessageError сообщает, что сообщение уже было обработано ранее
+func NewDuplicateMessageError() *AppError {
+	return WrapError(ErrorTypeConflict, "Message already processed", ErrDuplicateMessage)
+}
+
+// NewVersionConflictError сообщает, что ресурс был изменен другим запросом после чтения
+func NewVersionConflictError(resource string) *AppError {
+	return WrapError(ErrorTypeConflict, fmt.Sprintf("%s was modified concurrently", resource), ErrVersionConflict)
+}
+
+// NewDeletedOrderConflictError сообщает, что UID занят удаленным заказом: он освобождается
+// только после архивации заказа
+func NewDeletedOrderConflictError() *AppError {
+	return WrapError(ErrorTypeConflict, "order with this uid was deleted and the uid is reserved until it is archived", ErrOrderDeleted)
+}
+
+// IsVersionConflict проверяет, вызвана ли ошибка конкурентным изменением ресурса
+func IsVersionConflict(err error) bool {
+	return errors.Is(err, ErrVersionConflict)
+}
+
+// IsDuplicateMessage проверяет, вызвана ли ошибка повторной обработкой сообщения
+func IsDuplicateMessage(err error) bool {
+	return errors.Is(err, ErrDuplicateMessage)
+}
+
 // IsErrorType проверяет, является ли ошибка определенного типа
 func IsErrorType(err error, errType ErrorType) bool {
 	var appErr *AppError
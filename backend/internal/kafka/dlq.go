@@ -0,0 +1,183 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	errors2 "github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/metrics"
+)
+
+// Заголовки, которые добавляются к сообщению при отправке в dead-letter топик
+const (
+	headerDLQReason         = "dlq-reason"
+	headerDLQAttempts       = "dlq-attempts"
+	headerDLQOriginalTopic  = "dlq-original-topic"
+	headerDLQPartition      = "dlq-original-partition"
+	headerDLQOffset         = "dlq-original-offset"
+	headerDLQTimestamp      = "dlq-timestamp"
+	headerDLQOriginalKey    = "dlq-original-key"
+	headerDLQOriginalTimeMs = "dlq-original-timestamp"
+	headerDLQStage          = "dlq-rejection-stage"
+	headerDLQViolations     = "dlq-violations"
+)
+
+// errMalformedMessage означает, что сообщение не удалось разобрать, повторять обработку бессмысленно
+var errMalformedMessage = errors.New("malformed message")
+
+// newDLQWriter создает writer для dead-letter топика
+func newDLQWriter(brokers []string, topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Topic:                  topic,
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	}
+}
+
+// processWithRetry обрабатывает сообщение с ограниченным числом повторов и экспоненциальной задержкой.
+// Возвращает последнюю ошибку и количество выполненных попыток
+func (c *consumer) processWithRetry(ctx context.Context, message kafka.Message) (int, error) {
+	maxAttempts := c.config.Kafka.MaxRetries + 1
+	backoff := c.config.Kafka.RetryBackoff
+
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = c.processMessage(ctx, message); err == nil {
+			return attempt, nil
+		}
+
+		if !isRetryable(err) || attempt == maxAttempts {
+			return attempt, err
+		}
+
+		log.Printf("Ошибка обработки сообщения (попытка %d/%d), повтор через %s: %v",
+			attempt, maxAttempts, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > c.config.Kafka.RetryMaxBackoff {
+			backoff = c.config.Kafka.RetryMaxBackoff
+		}
+	}
+
+	return maxAttempts, err
+}
+
+// isRetryable определяет, имеет ли смысл повторять обработку сообщения после ошибки
+func isRetryable(err error) bool {
+	if errors.Is(err, errMalformedMessage) || errors.Is(err, errDuplicateSkipped) {
+		return false
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return false
+	}
+
+	if errors2.IsErrorType(err, errors2.ErrorTypeValidation) {
+		return false
+	}
+
+	// UID удаленного заказа освобождается только при архивации, повторы не помогут
+	if errors.Is(err, errors2.ErrOrderDeleted) {
+		return false
+	}
+
+	return true
+}
+
+// sendToDLQWithRetry публикует сообщение в DLQ, повторяя попытки до успеха или отмены контекста,
+// чтобы не зафиксировать offset сообщения, которое никуда не было сохранено.
+// Без DLQ возвращает ошибку: offset сообщения остается незафиксированным, и после перезапуска
+// сообщение будет прочитано повторно
+func (c *consumer) sendToDLQWithRetry(ctx context.Context, message kafka.Message, attempts int, reason error) error {
+	if c.dlqWriter == nil {
+		log.Printf("DLQ не настроен, offset сообщения не фиксируется: offset=%d, partition=%d, reason=%v",
+			message.Offset, message.Partition, reason)
+		return fmt.Errorf("dead-letter topic is not configured: %w", reason)
+	}
+
+	backoff := c.config.Kafka.RetryBackoff
+
+	for {
+		err := c.sendToDLQ(ctx, message, attempts, reason)
+		if err == nil {
+			return nil
+		}
+
+		log.Printf("Ошибка отправки сообщения в DLQ, повтор через %s: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > c.config.Kafka.RetryMaxBackoff {
+			backoff = c.config.Kafka.RetryMaxBackoff
+		}
+	}
+}
+
+// sendToDLQ публикует исходное сообщение в dead-letter топик вместе с метаданными об ошибке
+func (c *consumer) sendToDLQ(ctx context.Context, message kafka.Message, attempts int, reason error) error {
+	if c.dlqWriter == nil {
+		return fmt.Errorf("dead-letter topic is not configured")
+	}
+
+	headers := make([]kafka.Header, 0, len(message.Headers)+10)
+	headers = append(headers, message.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: headerDLQReason, Value: []byte(reason.Error())},
+		kafka.Header{Key: headerDLQAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: headerDLQOriginalTopic, Value: []byte(message.Topic)},
+		kafka.Header{Key: headerDLQPartition, Value: []byte(strconv.Itoa(message.Partition))},
+		kafka.Header{Key: headerDLQOffset, Value: []byte(strconv.FormatInt(message.Offset, 10))},
+		kafka.Header{Key: headerDLQOriginalKey, Value: message.Key},
+		kafka.Header{Key: headerDLQOriginalTimeMs, Value: []byte(strconv.FormatInt(message.Time.UnixMilli(), 10))},
+		kafka.Header{Key: headerDLQTimestamp, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+	)
+
+	// Для отклоненных сообщений передаем причины по полям
+	var rejection *RejectionError
+	if errors.As(reason, &rejection) {
+		violations, err := json.Marshal(rejection.Violations)
+		if err == nil {
+			headers = append(headers,
+				kafka.Header{Key: headerDLQStage, Value: []byte(rejection.Stage)},
+				kafka.Header{Key: headerDLQViolations, Value: violations},
+			)
+		}
+	}
+
+	dlqMessage := kafka.Message{
+		Key:     message.Key,
+		Value:   message.Value,
+		Headers: headers,
+	}
+
+	if err := c.dlqWriter.WriteMessages(ctx, dlqMessage); err != nil {
+		return fmt.Errorf("failed to publish message to dead-letter topic %s: %w", c.config.Kafka.DLQTopic, err)
+	}
+
+	metrics.KafkaMessagesDLQ.WithLabelValues(message.Topic).Inc()
+	log.Printf("Сообщение отправлено в DLQ %s: offset=%d, partition=%d, attempts=%d, reason=%v",
+		c.config.Kafka.DLQTopic, message.Offset, message.Partition, attempts, reason)
+	return nil
+}
@@ -0,0 +1,198 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Заголовки конверта, если метаданные передаются в заголовках сообщения
+const (
+	headerSchemaVersion = "schema_version"
+	headerEventType     = "event_type"
+	headerEventID       = "event_id"
+	headerProducedAt    = "produced_at"
+)
+
+// Этапы разбора конверта
+const (
+	stageEnvelope = "envelope"
+	stageUpcast   = "upcast"
+)
+
+// EventTypeOrderUpserted событие создания или обновления заказа, публикуемое producer'ами заказов
+const EventTypeOrderUpserted = "order.upserted"
+
+// legacySchemaVersion версия сообщений без конверта: плоский model.Order, в том числе
+// со служебными полями БД (id, created_at, version и т.д.), которые не допускает схема v1
+const legacySchemaVersion = 0
+
+// Envelope конверт сообщения о заказе. Метаданные передаются либо в заголовках
+// (тогда тело сообщения - это payload), либо в теле вместе с полем payload
+type Envelope struct {
+	SchemaVersion int             `json:"schema_version"`
+	EventType     string          `json:"event_type"`
+	EventID       string          `json:"event_id"`
+	ProducedAt    time.Time       `json:"produced_at"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// unwrapEnvelope извлекает конверт из сообщения. Сообщения без конверта
+// считаются сообщениями legacySchemaVersion
+func unwrapEnvelope(message kafka.Message) (*Envelope, error) {
+	// Конверт в теле сообщения: объект с полем schema_version или payload
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(message.Value, &fields); err == nil {
+		_, hasVersion := fields[headerSchemaVersion]
+		_, hasPayload := fields["payload"]
+		if hasVersion || hasPayload {
+			return parseBodyEnvelope(message.Value)
+		}
+	}
+
+	envelope := &Envelope{
+		SchemaVersion: legacySchemaVersion,
+		Payload:       bytes.TrimSpace(message.Value),
+	}
+
+	// Конверт в заголовках сообщения
+	for _, header := range message.Headers {
+		value := string(header.Value)
+		switch header.Key {
+		case headerSchemaVersion:
+			version, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, rejectEnvelope(headerSchemaVersion, "must be an integer")
+			}
+			envelope.SchemaVersion = version
+		case headerEventType:
+			envelope.EventType = value
+		case headerEventID:
+			envelope.EventID = value
+		case headerProducedAt:
+			producedAt, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, rejectEnvelope(headerProducedAt, "must be an RFC 3339 timestamp")
+			}
+			envelope.ProducedAt = producedAt
+		}
+	}
+
+	return envelope, nil
+}
+
+// parseBodyEnvelope разбирает конверт в теле сообщения. Некорректный конверт отклоняется,
+// а не обрабатывается как сообщение без конверта
+func parseBodyEnvelope(value []byte) (*Envelope, error) {
+	var body struct {
+		SchemaVersion *int `json:"schema_version"`
+		Envelope
+	}
+	if err := json.Unmarshal(value, &body); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		var timeErr *time.ParseError
+		switch {
+		case errors.As(err, &typeErr):
+			return nil, rejectEnvelope(typeErr.Field, fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value))
+		case errors.As(err, &timeErr):
+			return nil, rejectEnvelope(headerProducedAt, "must be an RFC 3339 timestamp")
+		default:
+			return nil, rejectEnvelope("$", err.Error())
+		}
+	}
+
+	if body.SchemaVersion == nil {
+		return nil, rejectEnvelope(headerSchemaVersion, "is required")
+	}
+	if payload := bytes.TrimSpace(body.Payload); len(payload) == 0 || bytes.Equal(payload, []byte("null")) {
+		return nil, rejectEnvelope("payload", "is required")
+	}
+
+	envelope := body.Envelope
+	envelope.SchemaVersion = *body.SchemaVersion
+	return &envelope, nil
+}
+
+// rejectEnvelope формирует отказ по некорректным метаданным конверта
+func rejectEnvelope(field, reason string) *RejectionError {
+	return &RejectionError{
+		Stage:      stageEnvelope,
+		Violations: []FieldViolation{{Field: field, Reason: reason}},
+	}
+}
+
+// Upcaster преобразует payload версии N в payload версии N+1
+type Upcaster func(payload json.RawMessage) (json.RawMessage, error)
+
+// UpcasterRegistry хранит преобразования между соседними версиями схемы и позволяет
+// обрабатывать сообщения старых версий, пока producer'ы переходят на новую
+type UpcasterRegistry struct {
+	current   int
+	upcasters map[int]Upcaster
+}
+
+// NewUpcasterRegistry создает реестр, приводящий сообщения к версии current
+func NewUpcasterRegistry(current int) *UpcasterRegistry {
+	return &UpcasterRegistry{
+		current:   current,
+		upcasters: make(map[int]Upcaster),
+	}
+}
+
+// Register добавляет преобразование из версии fromVersion в fromVersion+1
+func (r *UpcasterRegistry) Register(fromVersion int, upcaster Upcaster) {
+	r.upcasters[fromVersion] = upcaster
+}
+
+// Upcast последовательно приводит payload версии version к текущей версии схемы
+func (r *UpcasterRegistry) Upcast(version int, payload json.RawMessage) (json.RawMessage, error) {
+	if version > r.current {
+		return nil, rejectUpcast(version, fmt.Sprintf("unsupported schema version %d, latest known is %d", version, r.current))
+	}
+
+	for v := version; v < r.current; v++ {
+		upcaster, ok := r.upcasters[v]
+		if !ok {
+			return nil, rejectUpcast(version, fmt.Sprintf("no upcaster from schema version %d to %d", v, v+1))
+		}
+
+		var err error
+		if payload, err = upcaster(payload); err != nil {
+			return nil, rejectUpcast(version, fmt.Sprintf("upcast from version %d failed: %v", v, err))
+		}
+	}
+
+	return payload, nil
+}
+
+// rejectUpcast формирует отказ для сообщения, которое нельзя привести к текущей версии
+func rejectUpcast(version int, reason string) *RejectionError {
+	return &RejectionError{
+		Stage:         stageUpcast,
+		SchemaVersion: version,
+		Violations:    []FieldViolation{{Field: headerSchemaVersion, Reason: reason}},
+	}
+}
+
+// defaultUpcasters реестр преобразований для текущей схемы заказа.
+// При выпуске новой версии схемы сюда добавляется преобразование из предыдущей
+func defaultUpcasters() *UpcasterRegistry {
+	registry := NewUpcasterRegistry(orderSchemaVersion)
+	registry.Register(legacySchemaVersion, upcastLegacyOrder)
+	return registry
+}
+
+// upcastLegacyOrder приводит плоский model.Order (версия 0) к payload версии 1:
+// поля заказа переносятся без изменений, служебные поля БД отбрасываются
+func upcastLegacyOrder(payload json.RawMessage) (json.RawMessage, error) {
+	var order orderPayload
+	if err := json.Unmarshal(payload, &order); err != nil {
+		return nil, err
+	}
+	return json.Marshal(order)
+}
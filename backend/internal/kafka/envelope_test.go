@@ -0,0 +1,133 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestUnwrapEnvelope(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		value   string
+		headers []kafka.Header
+		version int
+		field   string
+	}{
+		{name: "legacy flat order", value: `{"order_uid":"order-uid-legacy"}`, version: legacySchemaVersion},
+		{
+			name:    "headers envelope",
+			value:   `{"order_uid":"order-uid-headers"}`,
+			headers: []kafka.Header{{Key: headerSchemaVersion, Value: []byte("1")}},
+			version: 1,
+		},
+		{name: "body envelope", value: `{"schema_version":1,"payload":{"order_uid":"order-uid-body"}}`, version: 1},
+		{name: "body envelope with string version", value: `{"schema_version":"1","payload":{}}`, field: "schema_version"},
+		{name: "body envelope without version", value: `{"payload":{"order_uid":"order-uid-body"}}`, field: "schema_version"},
+		{name: "body envelope without payload", value: `{"schema_version":1}`, field: "payload"},
+		{name: "body envelope with null payload", value: `{"schema_version":1,"payload":null}`, field: "payload"},
+		{name: "body envelope with bad timestamp", value: `{"schema_version":1,"produced_at":"yesterday","payload":{}}`, field: "produced_at"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			envelope, err := unwrapEnvelope(kafka.Message{Value: []byte(tc.value), Headers: tc.headers})
+
+			if tc.field != "" {
+				var rejection *RejectionError
+				if !errors.As(err, &rejection) || rejection.Stage != stageEnvelope {
+					t.Fatalf("expected envelope rejection, got %v", err)
+				}
+				if rejection.Violations[0].Field != tc.field {
+					t.Fatalf("expected violation of %s, got %+v", tc.field, rejection.Violations)
+				}
+				if isRetryable(err) {
+					t.Fatal("malformed envelope must not be retried")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if envelope.SchemaVersion != tc.version {
+				t.Fatalf("expected schema version %d, got %d", tc.version, envelope.SchemaVersion)
+			}
+		})
+	}
+}
+
+func TestUpcasterRegistry(t *testing.T) {
+	// Фейковые преобразования дописывают номер версии, чтобы проверить порядок применения
+	appendVersion := func(version string) Upcaster {
+		return func(payload json.RawMessage) (json.RawMessage, error) {
+			return json.RawMessage(strings.TrimSuffix(string(payload), `"`) + version + `"`), nil
+		}
+	}
+
+	registry := NewUpcasterRegistry(3)
+	registry.Register(1, appendVersion("2"))
+	registry.Register(2, appendVersion("3"))
+
+	payload, err := registry.Upcast(1, json.RawMessage(`"1"`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(payload) != `"123"` {
+		t.Fatalf("expected upcasters applied in order, got %s", payload)
+	}
+
+	if payload, err = registry.Upcast(3, json.RawMessage(`"3"`)); err != nil || string(payload) != `"3"` {
+		t.Fatalf("current version must pass unchanged, got %s, %v", payload, err)
+	}
+
+	for _, version := range []int{0, 4} {
+		var rejection *RejectionError
+		if _, err = registry.Upcast(version, json.RawMessage(`"0"`)); !errors.As(err, &rejection) || rejection.Stage != stageUpcast {
+			t.Fatalf("expected upcast rejection for version %d, got %v", version, err)
+		}
+	}
+
+	registry.Register(0, func(json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("broken payload")
+	})
+	if _, err = registry.Upcast(0, json.RawMessage(`"0"`)); !errors.Is(err, errMalformedMessage) {
+		t.Fatalf("failed upcast must reject the message, got %v", err)
+	}
+}
+
+func TestDecodeLegacyOrder(t *testing.T) {
+	const uid = "order-uid-legacy"
+
+	// Сообщение без конверта в формате model.Order со служебными полями БД
+	legacy, err := json.Marshal(testOrder(uid))
+	if err != nil {
+		t.Fatalf("marshal order: %v", err)
+	}
+	if !strings.Contains(string(legacy), `"created_at"`) {
+		t.Fatal("legacy message must contain service fields")
+	}
+
+	c := newConsumer(nil, nil, newFakeOrderService(), testConfig())
+	order, err := c.decodeOrder(kafka.Message{Topic: "orders", Key: []byte(uid), Value: legacy})
+	if err != nil {
+		t.Fatalf("legacy message rejected: %v", err)
+	}
+	if order.OrderUID != uid || order.Source.SchemaVersion != legacySchemaVersion {
+		t.Fatalf("unexpected order %s with schema version %d", order.OrderUID, order.Source.SchemaVersion)
+	}
+	if len(order.Items) != 1 || order.Payment.Amount != 1817 {
+		t.Fatal("order fields must survive the upcast")
+	}
+
+	// Тот же payload в текущей версии схемы не допускает служебных полей
+	current := kafka.Message{
+		Topic:   "orders",
+		Value:   legacy,
+		Headers: []kafka.Header{{Key: headerSchemaVersion, Value: []byte("1")}},
+	}
+	if _, err = c.decodeOrder(current); !errors.Is(err, errMalformedMessage) {
+		t.Fatalf("expected v1 message with service fields to be rejected, got %v", err)
+	}
+}
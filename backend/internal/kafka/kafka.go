@@ -2,26 +2,60 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"log"
+	"sort"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 
 	"github.com/makhkets/wildberries-l0/internal/config"
+	errors2 "github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/metrics"
 	"github.com/makhkets/wildberries-l0/internal/model"
 	"github.com/makhkets/wildberries-l0/internal/service"
 )
 
+// readerStatsInterval период сбора статистики reader'а
+const readerStatsInterval = 10 * time.Second
+
+// errDuplicateSkipped означает, что сообщение уже было обработано и пропущено;
+// offset такого сообщения фиксируется, но оно не учитывается как успешно обработанное
+var errDuplicateSkipped = errors.New("duplicate message skipped")
+
 type Consumer interface {
 	Start(ctx context.Context) error
 	Close() error
 }
 
+// messageReader описывает чтение сообщений с явной фиксацией offset'ов.
+// Реализуется *kafka.Reader, в тестах может быть подменен фейковой реализацией
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// messageWriter описывает публикацию сообщений (используется для DLQ)
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
 type consumer struct {
-	reader       *kafka.Reader
+	reader       messageReader
+	dlqWriter    messageWriter
 	orderService service.Order
+	validator    *orderValidator
+	upcasters    *UpcasterRegistry
 	config       *config.Config
+
+	// duplicates количество пропущенных повторно прочитанных сообщений
+	duplicates atomic.Int64
 }
 
 // NewConsumer создает новый Kafka consumer
@@ -34,59 +68,137 @@ func NewConsumer(cfg *config.Config, orderService service.Order) Consumer {
 		MaxBytes:    10e6, // 10MB
 		MaxWait:     1 * time.Second,
 		StartOffset: kafka.LastOffset,
+		// Offset'ы фиксируются вручную и синхронно, только после сохранения заказа
+		CommitInterval: 0,
 	})
 
+	var dlqWriter messageWriter
+	if cfg.Kafka.DLQTopic != "" {
+		dlqWriter = newDLQWriter(cfg.Kafka.Brokers, cfg.Kafka.DLQTopic)
+	}
+
+	return newConsumer(reader, dlqWriter, orderService, cfg)
+}
+
+// newConsumer собирает consumer из готовых reader и writer
+func newConsumer(reader messageReader, dlqWriter messageWriter, orderService service.Order, cfg *config.Config) *consumer {
 	return &consumer{
 		reader:       reader,
+		dlqWriter:    dlqWriter,
 		orderService: orderService,
+		validator:    mustNewOrderValidator(orderService),
+		upcasters:    defaultUpcasters(),
 		config:       cfg,
 	}
 }
 
-// Start запускает процесс чтения сообщений из Kafka
+// Start запускает процесс чтения сообщений из Kafka.
+// Используется модель fetch/process/commit: offset фиксируется только после того,
+// как заказ сохранен в БД (или сообщение отправлено в DLQ), поэтому при падении
+// между чтением и сохранением сообщение будет прочитано повторно (at-least-once).
+// Сообщения обрабатываются пулом воркеров с сохранением порядка по ключу заказа,
+// offset'ы фиксируются по порядку внутри каждой партиции
 func (c *consumer) Start(ctx context.Context) error {
-	log.Println("Запуск Kafka consumer для топика:", c.config.Kafka.Topic)
+	log.Println("Запуск Kafka consumer для топика:", c.config.Kafka.Topic,
+		"воркеров:", c.config.Kafka.Workers)
+
+	committer := newOffsetCommitter(c.reader, c.config.Kafka.Workers*c.config.Kafka.WorkerQueueSize)
+	go committer.run()
+
+	pool := newWorkerPool(c.config.Kafka.Workers, c.config.Kafka.WorkerQueueSize, c.handleBatch, committer.events)
+	pool.batchSize, pool.batchTimeout = c.config.Kafka.BatchSize, c.config.Kafka.BatchTimeout
+	pool.start(ctx)
+
+	go c.reportReaderStats(ctx)
 
 	for {
 		select {
 		case <-ctx.Done():
 			log.Println("Остановка Kafka consumer")
+			pool.stop()
+			committer.stop()
 			return c.reader.Close()
 		default:
-			// Читаем сообщение из Kafka
-			message, err := c.reader.ReadMessage(ctx)
+			// Читаем сообщение из Kafka без фиксации offset'а
+			message, err := c.reader.FetchMessage(ctx)
 			if err != nil {
-				log.Printf("Ошибка чтения сообщения из Kafka: %v", err)
+				if ctx.Err() == nil {
+					log.Printf("Ошибка чтения сообщения из Kafka: %v", err)
+				}
 				continue
 			}
 
-			// Обрабатываем сообщение
-			if err = c.processMessage(ctx, message); err != nil {
-				log.Printf("Ошибка обработки сообщения: %v", err)
+			metrics.KafkaMessagesConsumed.WithLabelValues(message.Topic).Inc()
+			observeLag(message)
+
+			committer.track(message)
+			if err = pool.dispatch(ctx, message); err != nil {
+				// Consumer останавливается: offset не фиксируем,
+				// сообщение будет прочитано снова после перезапуска
 				continue
 			}
-
-			log.Printf("Успешно обработано сообщение: offset=%d, partition=%d",
-				message.Offset, message.Partition)
 		}
 	}
 }
 
+// handleMessage обрабатывает сообщение с повторами, а при неудаче отправляет его в DLQ.
+// Возвращает nil, если offset сообщения можно фиксировать
+func (c *consumer) handleMessage(ctx context.Context, message kafka.Message) error {
+	start := time.Now()
+	attempts, err := c.processWithRetry(ctx, message)
+	metrics.KafkaProcessingDuration.WithLabelValues(message.Topic).Observe(time.Since(start).Seconds())
+
+	// Пропуск уже учтен в счетчике повторов
+	if errors.Is(err, errDuplicateSkipped) {
+		return nil
+	}
+
+	if err == nil {
+		metrics.KafkaMessagesSucceeded.WithLabelValues(message.Topic).Inc()
+		log.Printf("Успешно обработано сообщение: offset=%d, partition=%d",
+			message.Offset, message.Partition)
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	metrics.KafkaMessagesFailed.WithLabelValues(message.Topic).Inc()
+	log.Printf("Ошибка обработки сообщения после %d попыток: %v", attempts, err)
+
+	// Сообщение считается обработанным только после успешной публикации в DLQ
+	return c.sendToDLQWithRetry(ctx, message, attempts, err)
+}
+
 // processMessage обрабатывает отдельное сообщение
 func (c *consumer) processMessage(ctx context.Context, message kafka.Message) error {
 	log.Printf("Получено сообщение: key=%s, offset=%d, partition=%d",
 		string(message.Key), message.Offset, message.Partition)
 
-	// Парсим JSON сообщение в структуру Order
-	var order model.Order
-	if err := json.Unmarshal(message.Value, &order); err != nil {
+	order, err := c.decodeOrder(message)
+	if err != nil {
 		return err
 	}
 
+	// Повторно прочитанное сообщение уже сохранено вместе с заказом - пропускаем его
+	processed, err := c.orderService.IsMessageProcessed(ctx, order.Source)
+	if err != nil {
+		return err
+	}
+	if processed {
+		c.skipDuplicate(message)
+		return errDuplicateSkipped
+	}
+
 	log.Printf("Обработка заказа: %s", order.OrderUID)
 
 	// Сохраняем заказ через сервис
-	if err := c.orderService.CreateOrder(ctx, &order); err != nil {
+	if err = c.orderService.CreateOrder(ctx, order); err != nil {
+		if errors.Is(err, errors2.ErrDuplicateMessage) {
+			c.skipDuplicate(message)
+			return errDuplicateSkipped
+		}
 		return err
 	}
 
@@ -94,8 +206,180 @@ func (c *consumer) processMessage(ctx context.Context, message kafka.Message) er
 	return nil
 }
 
+// handleBatch обрабатывает пачку сообщений одного воркера: корректные заказы сохраняются
+// одним пакетом, а сообщения, которые не удалось разобрать или сохранить, обрабатываются
+// по одному с повторами и отправкой в DLQ. Возвращает результат для каждого сообщения.
+// В пакет попадает только первое сообщение каждого ключа: остальные сообщения ключа
+// обрабатываются по одному в порядке offset'ов после него, чтобы неудачное сообщение,
+// обработанное повторно, не перезаписало более новую версию заказа
+func (c *consumer) handleBatch(ctx context.Context, messages []kafka.Message) []error {
+	start := time.Now()
+	results := make([]error, len(messages))
+	if len(messages) == 1 {
+		results[0] = c.handleMessage(ctx, messages[0])
+		return results
+	}
+
+	orders := make([]*model.Order, 0, len(messages))
+	indexes := make([]int, 0, len(messages))
+	// sequential сообщения, обрабатываемые по одному после сохранения пакета
+	var sequential []int
+	// batched ключи, сообщение которых уже есть в пакете; ordered - ключи, остаток которых
+	// обрабатывается по одному
+	batched := make(map[string]bool)
+	ordered := make(map[string]bool)
+
+	for i, message := range messages {
+		key := string(message.Key)
+		if batched[key] || ordered[key] {
+			sequential = append(sequential, i)
+			continue
+		}
+
+		order, err := c.decodeOrder(message)
+		if err != nil {
+			sequential = append(sequential, i)
+			ordered[key] = true
+			continue
+		}
+
+		processed, err := c.orderService.IsMessageProcessed(ctx, order.Source)
+		if err != nil {
+			sequential = append(sequential, i)
+			ordered[key] = true
+			continue
+		}
+		if processed {
+			c.skipDuplicate(message)
+			continue
+		}
+
+		orders = append(orders, order)
+		indexes = append(indexes, i)
+		batched[key] = true
+	}
+
+	if len(orders) > 0 {
+		errs := c.orderService.CreateOrders(ctx, orders)
+		elapsed := time.Since(start).Seconds()
+
+		for j, err := range errs {
+			message := messages[indexes[j]]
+			switch {
+			case err == nil:
+				// Учитываем сообщения, успешно сохраненные пакетом
+				metrics.KafkaMessagesSucceeded.WithLabelValues(message.Topic).Inc()
+				metrics.KafkaProcessingDuration.WithLabelValues(message.Topic).Observe(elapsed)
+			case errors.Is(err, errors2.ErrDuplicateMessage):
+				c.skipDuplicate(message)
+			default:
+				log.Printf("Ошибка пакетного сохранения заказа %s: %v", orders[j].OrderUID, err)
+				sequential = append(sequential, indexes[j])
+			}
+		}
+	}
+	sort.Ints(sequential)
+
+	// Остальные сообщения проходят обычный путь (повторы, затем DLQ) в порядке offset'ов.
+	// Если сообщение не обработано, следующие сообщения его ключа тоже не обрабатываются:
+	// их offset'ы не будут зафиксированы, и после перезапуска ключ обработается заново по порядку
+	stopped := make(map[string]error)
+	for _, i := range sequential {
+		key := string(messages[i].Key)
+		if err, ok := stopped[key]; ok {
+			results[i] = err
+			continue
+		}
+
+		if results[i] = c.handleMessage(ctx, messages[i]); results[i] != nil {
+			stopped[key] = results[i]
+		}
+	}
+
+	log.Printf("Обработана пачка сообщений: всего=%d, по одному=%d", len(messages), len(sequential))
+	return results
+}
+
+// decodeOrder извлекает конверт, приводит payload к текущей версии схемы, проверяет его,
+// строго разбирает в структуру Order, валидирует заказ и запоминает источник заказа
+func (c *consumer) decodeOrder(message kafka.Message) (*model.Order, error) {
+	envelope, err := unwrapEnvelope(message)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := c.upcasters.Upcast(envelope.SchemaVersion, envelope.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := c.validator.decode(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(message.Value)
+	order.Source = &model.MessageSource{
+		Topic:       message.Topic,
+		Partition:   message.Partition,
+		Offset:      message.Offset,
+		Key:         string(message.Key),
+		ContentHash: hex.EncodeToString(hash[:]),
+
+		SchemaVersion: envelope.SchemaVersion,
+		EventType:     envelope.EventType,
+		EventID:       envelope.EventID,
+		ProducedAt:    envelope.ProducedAt,
+	}
+
+	return order, nil
+}
+
+// skipDuplicate учитывает и логирует пропуск уже обработанного сообщения
+func (c *consumer) skipDuplicate(message kafka.Message) {
+	metrics.KafkaMessagesDuplicate.WithLabelValues(message.Topic).Inc()
+	total := c.duplicates.Add(1)
+	log.Printf("Сообщение уже обработано, пропускаем: key=%s, offset=%d, partition=%d, всего пропущено=%d",
+		string(message.Key), message.Offset, message.Partition, total)
+}
+
+// observeLag обновляет отставание партиции по high watermark прочитанного сообщения
+func observeLag(message kafka.Message) {
+	lag := message.HighWaterMark - message.Offset - 1
+	if lag < 0 {
+		lag = 0
+	}
+	metrics.KafkaPartitionLag.WithLabelValues(message.Topic, strconv.Itoa(message.Partition)).Set(float64(lag))
+}
+
+// reportReaderStats периодически публикует отставание из статистики reader'а, если она доступна
+func (c *consumer) reportReaderStats(ctx context.Context) {
+	reader, ok := c.reader.(interface{ Stats() kafka.ReaderStats })
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(readerStatsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats := reader.Stats()
+			metrics.KafkaReaderLag.WithLabelValues(stats.Topic).Set(float64(stats.Lag))
+		}
+	}
+}
+
 // Close закрывает соединение с Kafka
 func (c *consumer) Close() error {
+	if c.dlqWriter != nil {
+		if err := c.dlqWriter.Close(); err != nil {
+			log.Printf("Ошибка закрытия DLQ writer: %v", err)
+		}
+	}
 	if c.reader != nil {
 		return c.reader.Close()
 	}
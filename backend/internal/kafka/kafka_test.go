@@ -0,0 +1,570 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/makhkets/wildberries-l0/internal/config"
+	errors2 "github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/metrics"
+	"github.com/makhkets/wildberries-l0/internal/model"
+	"github.com/makhkets/wildberries-l0/internal/service"
+)
+
+// waitTimeout ограничивает ожидание асинхронных событий в тестах
+const waitTimeout = 5 * time.Second
+
+// fakeBroker журнал сообщений топика и зафиксированные offset'ы группы.
+// Переживает перезапуск consumer'а: новый reader читает с последнего зафиксированного offset'а
+type fakeBroker struct {
+	mu        sync.Mutex
+	messages  []kafka.Message
+	committed map[int]int64
+	commits   []kafka.Message
+	// failCommits имитирует падение процесса между сохранением заказа и фиксацией offset'а
+	failCommits bool
+}
+
+func newFakeBroker(messages ...kafka.Message) *fakeBroker {
+	return &fakeBroker{messages: messages, committed: make(map[int]int64)}
+}
+
+// reader создает reader, который отдает незафиксированные сообщения, а затем ждет отмены контекста
+func (b *fakeBroker) reader() *fakeReader {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	queue := make(chan kafka.Message, len(b.messages))
+	for _, message := range b.messages {
+		if message.Offset >= b.committed[message.Partition] {
+			queue <- message
+		}
+	}
+	return &fakeReader{broker: b, queue: queue}
+}
+
+// committedOffset следующий offset партиции, с которого начнет чтение группа
+func (b *fakeBroker) committedOffset(partition int) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.committed[partition]
+}
+
+// commitLog зафиксированные сообщения в порядке фиксации
+func (b *fakeBroker) commitLog() []kafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]kafka.Message(nil), b.commits...)
+}
+
+func (b *fakeBroker) setFailCommits(fail bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failCommits = fail
+}
+
+// fakeReader реализация messageReader поверх fakeBroker
+type fakeReader struct {
+	broker *fakeBroker
+	queue  chan kafka.Message
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case message := <-r.queue:
+		return message, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+
+	if r.broker.failCommits {
+		return errors.New("commit failed")
+	}
+	for _, message := range msgs {
+		r.broker.commits = append(r.broker.commits, message)
+		r.broker.committed[message.Partition] = message.Offset + 1
+	}
+	return nil
+}
+
+func (r *fakeReader) Close() error {
+	return nil
+}
+
+// fakeWriter реализация messageWriter, запоминающая опубликованные сообщения
+type fakeWriter struct {
+	mu       sync.Mutex
+	messages []kafka.Message
+	attempts int
+	err      error
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.attempts++
+	if w.err != nil {
+		return w.err
+	}
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	return nil
+}
+
+func (w *fakeWriter) written() (attempts, messages int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.attempts, len(w.messages)
+}
+
+// fakeOrderService сервис заказов в памяти с журналом обработанных сообщений, как в БД.
+// Остальные методы service.Order тестами не используются
+type fakeOrderService struct {
+	service.Order
+
+	mu        sync.Mutex
+	saved     map[string][]int64
+	processed map[string]bool
+	calls     map[string]int
+
+	// createHook вызывается перед сохранением заказа; ошибка прерывает сохранение
+	createHook func(ctx context.Context, order *model.Order) error
+	// skipLedgerLookup имитирует гонку: проверка журнала не видит сообщение,
+	// и повтор обнаруживается только при сохранении
+	skipLedgerLookup bool
+}
+
+func newFakeOrderService() *fakeOrderService {
+	return &fakeOrderService{
+		saved:     make(map[string][]int64),
+		processed: make(map[string]bool),
+		calls:     make(map[string]int),
+	}
+}
+
+func sourceKey(source *model.MessageSource) string {
+	return fmt.Sprintf("%s/%d/%d", source.Topic, source.Partition, source.Offset)
+}
+
+func (s *fakeOrderService) ValidateOrder(*model.Order) error {
+	return nil
+}
+
+func (s *fakeOrderService) IsMessageProcessed(_ context.Context, source *model.MessageSource) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.skipLedgerLookup && s.processed[sourceKey(source)], nil
+}
+
+func (s *fakeOrderService) CreateOrder(ctx context.Context, order *model.Order) error {
+	s.mu.Lock()
+	s.calls[order.OrderUID]++
+	hook := s.createHook
+	s.mu.Unlock()
+
+	if hook != nil {
+		if err := hook(ctx, order); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.processed[sourceKey(order.Source)] {
+		return errors2.NewDuplicateMessageError()
+	}
+	s.processed[sourceKey(order.Source)] = true
+	s.saved[order.OrderUID] = append(s.saved[order.OrderUID], order.Source.Offset)
+	return nil
+}
+
+func (s *fakeOrderService) CreateOrders(ctx context.Context, orders []*model.Order) []error {
+	errs := make([]error, len(orders))
+	for i, order := range orders {
+		errs[i] = s.CreateOrder(ctx, order)
+	}
+	return errs
+}
+
+func (s *fakeOrderService) storedCount(uid string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.saved[uid])
+}
+
+// savedOffsets offset'ы сообщений, из которых сохранялся заказ, в порядке сохранения
+func (s *fakeOrderService) savedOffsets(uid string) []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.saved[uid]...)
+}
+
+func (s *fakeOrderService) callCount(uid string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[uid]
+}
+
+// testConfig конфигурация consumer'а с короткими задержками и обработкой по одному сообщению
+func testConfig() *config.Config {
+	return &config.Config{
+		Kafka: config.Kafka{
+			Topic:           "orders",
+			DLQTopic:        "orders.dlq",
+			MaxRetries:      1,
+			RetryBackoff:    time.Millisecond,
+			RetryMaxBackoff: 5 * time.Millisecond,
+			Workers:         2,
+			WorkerQueueSize: 8,
+			BatchSize:       1,
+			BatchTimeout:    10 * time.Millisecond,
+		},
+	}
+}
+
+// testMessage сообщение о заказе uid по адресу partition/offset
+func testMessage(t *testing.T, partition int, offset int64, uid string) kafka.Message {
+	t.Helper()
+
+	value, err := EncodeOrder(testOrder(uid))
+	if err != nil {
+		t.Fatalf("encode order: %v", err)
+	}
+
+	return kafka.Message{
+		Topic:         "orders",
+		Partition:     partition,
+		Offset:        offset,
+		HighWaterMark: offset + 1,
+		Key:           []byte(uid),
+		Value:         value,
+	}
+}
+
+// testOrder заказ, проходящий проверку по JSON Schema
+func testOrder(uid string) *model.Order {
+	return &model.Order{
+		OrderUID:        uid,
+		TrackNumber:     "WBILMTESTTRACK",
+		Entry:           "WBIL",
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		Shardkey:        "9",
+		SmID:            99,
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		OofShard:        "1",
+		Delivery: &model.Delivery{
+			Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com",
+		},
+		Payment: &model.Payment{
+			Transaction: uid, Currency: "USD", Provider: "wbpay", Amount: 1817,
+			PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317,
+		},
+		Items: []model.Item{{
+			ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, RID: "ab4219087a764ae0btest",
+			Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202,
+		}},
+	}
+}
+
+// startConsumer запускает consumer и возвращает функцию остановки, дожидающуюся завершения Start
+func startConsumer(t *testing.T, c *consumer) (stop func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.Start(ctx) }()
+
+	return func() {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(waitTimeout):
+			t.Fatal("consumer did not stop")
+		}
+	}
+}
+
+// waitFor ждет выполнения условия
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(waitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// keysOnDifferentWorkers подбирает order_uid, которые обрабатываются разными воркерами пула
+func keysOnDifferentWorkers(t *testing.T, workers int) (string, string) {
+	t.Helper()
+
+	pool := newWorkerPool(workers, 1, nil, nil)
+	first := "order-uid-0000"
+	for i := 1; i < 100; i++ {
+		uid := fmt.Sprintf("order-uid-%04d", i)
+		if pool.workerFor(kafka.Message{Key: []byte(uid)}) != pool.workerFor(kafka.Message{Key: []byte(first)}) {
+			return first, uid
+		}
+	}
+	t.Fatal("no keys found for different workers")
+	return "", ""
+}
+
+func TestConsumerDoesNotCommitUnprocessedMessage(t *testing.T) {
+	const uid = "order-uid-failed"
+
+	t.Run("create order and dead-lettering fail", func(t *testing.T) {
+		broker := newFakeBroker(testMessage(t, 0, 0, uid))
+		orders := newFakeOrderService()
+		orders.createHook = func(context.Context, *model.Order) error {
+			return errors2.NewDatabaseError("insert order", errors.New("connection refused"))
+		}
+		dlq := &fakeWriter{err: errors.New("broker unavailable")}
+
+		cfg := testConfig()
+		stop := startConsumer(t, newConsumer(broker.reader(), dlq, orders, cfg))
+		waitFor(t, "dead-letter attempts", func() bool {
+			attempts, _ := dlq.written()
+			return orders.callCount(uid) == cfg.Kafka.MaxRetries+1 && attempts >= 2
+		})
+		stop()
+
+		if commits := broker.commitLog(); len(commits) != 0 {
+			t.Fatalf("expected no commits, got %d", len(commits))
+		}
+		if orders.storedCount(uid) != 0 {
+			t.Fatal("order must not be stored")
+		}
+	})
+
+	t.Run("committed after dead-lettering", func(t *testing.T) {
+		broker := newFakeBroker(testMessage(t, 0, 0, uid))
+		orders := newFakeOrderService()
+		orders.createHook = func(context.Context, *model.Order) error {
+			return errors2.NewDatabaseError("insert order", errors.New("connection refused"))
+		}
+		dlq := &fakeWriter{}
+
+		stop := startConsumer(t, newConsumer(broker.reader(), dlq, orders, testConfig()))
+		waitFor(t, "offset commit", func() bool { return broker.committedOffset(0) == 1 })
+		stop()
+
+		if _, messages := dlq.written(); messages != 1 {
+			t.Fatalf("expected 1 dead-lettered message, got %d", messages)
+		}
+	})
+
+	t.Run("no dead-letter topic", func(t *testing.T) {
+		const other = "order-uid-other"
+
+		broker := newFakeBroker(testMessage(t, 0, 0, uid), testMessage(t, 0, 1, other))
+		orders := newFakeOrderService()
+		orders.createHook = func(_ context.Context, order *model.Order) error {
+			if order.OrderUID == uid {
+				return errors2.NewValidationError("payment.amount", "does not match")
+			}
+			return nil
+		}
+
+		cfg := testConfig()
+		cfg.Kafka.BatchSize = 1
+		stop := startConsumer(t, newConsumer(broker.reader(), nil, orders, cfg))
+		waitFor(t, "next message stored", func() bool { return orders.storedCount(other) == 1 })
+		stop()
+
+		// Сообщение без DLQ не теряется: его offset и следующие за ним не фиксируются
+		if commits := broker.commitLog(); len(commits) != 0 {
+			t.Fatalf("expected no commits, got %d", len(commits))
+		}
+	})
+
+	t.Run("worker stopped mid-process", func(t *testing.T) {
+		broker := newFakeBroker(testMessage(t, 0, 0, uid))
+		orders := newFakeOrderService()
+		started := make(chan struct{})
+		orders.createHook = func(ctx context.Context, _ *model.Order) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		dlq := &fakeWriter{}
+
+		stop := startConsumer(t, newConsumer(broker.reader(), dlq, orders, testConfig()))
+		select {
+		case <-started:
+		case <-time.After(waitTimeout):
+			t.Fatal("message was not processed")
+		}
+		stop()
+
+		if commits := broker.commitLog(); len(commits) != 0 {
+			t.Fatalf("expected no commits, got %d", len(commits))
+		}
+		if _, messages := dlq.written(); messages != 0 {
+			t.Fatalf("interrupted message must not be dead-lettered, got %d", messages)
+		}
+	})
+}
+
+func TestConsumerRedeliveryStoresOrderOnce(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		skipLedgerLookup bool
+	}{
+		{name: "duplicate found in ledger"},
+		{name: "duplicate rejected on insert", skipLedgerLookup: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			broker := newFakeBroker(
+				testMessage(t, 0, 0, "order-uid-first"),
+				testMessage(t, 0, 1, "order-uid-second"),
+			)
+			orders := newFakeOrderService()
+
+			// Заказы сохранены, но процесс "упал" до фиксации offset'ов
+			broker.setFailCommits(true)
+			stop := startConsumer(t, newConsumer(broker.reader(), nil, orders, testConfig()))
+			waitFor(t, "orders stored", func() bool {
+				return orders.storedCount("order-uid-first") == 1 && orders.storedCount("order-uid-second") == 1
+			})
+			stop()
+
+			if broker.committedOffset(0) != 0 {
+				t.Fatal("offsets must not be committed before restart")
+			}
+
+			// После перезапуска те же сообщения читаются повторно
+			broker.setFailCommits(false)
+			orders.mu.Lock()
+			orders.skipLedgerLookup = tc.skipLedgerLookup
+			orders.mu.Unlock()
+
+			succeeded := testutil.ToFloat64(metrics.KafkaMessagesSucceeded.WithLabelValues("orders"))
+			duplicates := testutil.ToFloat64(metrics.KafkaMessagesDuplicate.WithLabelValues("orders"))
+
+			restarted := newConsumer(broker.reader(), nil, orders, testConfig())
+			stop = startConsumer(t, restarted)
+			waitFor(t, "offset commit", func() bool { return broker.committedOffset(0) == 2 })
+			stop()
+
+			// Пропущенные повторы учитываются только в счетчике повторов
+			if n := testutil.ToFloat64(metrics.KafkaMessagesSucceeded.WithLabelValues("orders")) - succeeded; n != 0 {
+				t.Errorf("skipped duplicates counted as succeeded: %v", n)
+			}
+			if n := testutil.ToFloat64(metrics.KafkaMessagesDuplicate.WithLabelValues("orders")) - duplicates; n != 2 {
+				t.Errorf("expected 2 duplicates in metrics, got %v", n)
+			}
+
+			for _, uid := range []string{"order-uid-first", "order-uid-second"} {
+				if n := orders.storedCount(uid); n != 1 {
+					t.Errorf("order %s stored %d times, want 1", uid, n)
+				}
+			}
+			if n := restarted.duplicates.Load(); n != 2 {
+				t.Errorf("expected 2 skipped duplicates, got %d", n)
+			}
+		})
+	}
+}
+
+func TestConsumerCommitsInOrderPerPartition(t *testing.T) {
+	slowUID, fastUID := keysOnDifferentWorkers(t, testConfig().Kafka.Workers)
+
+	broker := newFakeBroker(
+		testMessage(t, 0, 0, slowUID),
+		testMessage(t, 0, 1, fastUID),
+		testMessage(t, 1, 0, fastUID),
+	)
+	orders := newFakeOrderService()
+	release := make(chan struct{})
+	orders.createHook = func(ctx context.Context, order *model.Order) error {
+		if order.OrderUID != slowUID {
+			return nil
+		}
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	stop := startConsumer(t, newConsumer(broker.reader(), nil, orders, testConfig()))
+	defer stop()
+
+	// Более поздний offset партиции 0 обработан раньше, другая партиция фиксируется независимо
+	waitFor(t, "later offset stored", func() bool { return orders.storedCount(fastUID) == 2 })
+	waitFor(t, "partition 1 commit", func() bool { return broker.committedOffset(1) == 1 })
+	if offset := broker.committedOffset(0); offset != 0 {
+		t.Fatalf("partition 0 committed up to %d before offset 0 was processed", offset)
+	}
+
+	close(release)
+	waitFor(t, "partition 0 commit", func() bool { return broker.committedOffset(0) == 2 })
+
+	var partition0 []int64
+	for _, message := range broker.commitLog() {
+		if message.Partition == 0 {
+			partition0 = append(partition0, message.Offset)
+		}
+	}
+	if len(partition0) != 1 || partition0[0] != 1 {
+		t.Fatalf("expected a single partition 0 commit of offset 1, got %v", partition0)
+	}
+}
+
+func TestConsumerBatchKeepsKeyOrderOnFailure(t *testing.T) {
+	const uid = "order-uid-batched"
+
+	broker := newFakeBroker(
+		testMessage(t, 0, 0, uid),
+		testMessage(t, 0, 1, "order-uid-other"),
+		testMessage(t, 0, 2, uid),
+		testMessage(t, 0, 3, uid),
+	)
+	orders := newFakeOrderService()
+	// Первое сохранение самого старого сообщения заказа завершается временной ошибкой
+	failed := false
+	orders.createHook = func(_ context.Context, order *model.Order) error {
+		if order.OrderUID == uid && order.Source.Offset == 0 && !failed {
+			failed = true
+			return errors2.NewDatabaseError("insert order", errors.New("connection reset"))
+		}
+		return nil
+	}
+
+	cfg := testConfig()
+	cfg.Kafka.Workers, cfg.Kafka.BatchSize, cfg.Kafka.BatchTimeout = 1, 4, time.Second
+
+	stop := startConsumer(t, newConsumer(broker.reader(), nil, orders, cfg))
+	waitFor(t, "offset commit", func() bool { return broker.committedOffset(0) == 4 })
+	stop()
+
+	saved := orders.savedOffsets(uid)
+	if len(saved) != 3 || saved[0] != 0 || saved[1] != 2 || saved[2] != 3 {
+		t.Fatalf("order versions saved out of offset order: %v", saved)
+	}
+}
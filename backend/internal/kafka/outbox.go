@@ -0,0 +1,94 @@
+package kafka
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/makhkets/wildberries-l0/internal/config"
+	"github.com/makhkets/wildberries-l0/internal/db"
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// OutboxRelay публикует события из таблицы outbox в Kafka.
+// Событие помечается отправленным только после подтверждения записи в Kafka (at-least-once),
+// события публикуются в порядке записи с ключом order_uid, поэтому порядок событий
+// одного заказа сохраняется
+type OutboxRelay struct {
+	repo     db.Repo
+	producer Producer
+	config   *config.Config
+}
+
+// NewOutboxRelay создает relay для топика событий из конфигурации
+func NewOutboxRelay(cfg *config.Config, repo db.Repo) *OutboxRelay {
+	return &OutboxRelay{
+		repo:     repo,
+		producer: NewTopicProducer(cfg.Kafka.Brokers, cfg.Kafka.OutboxTopic),
+		config:   cfg,
+	}
+}
+
+// Start периодически публикует неотправленные события до отмены контекста
+func (r *OutboxRelay) Start(ctx context.Context) error {
+	log.Println("Запуск outbox relay для топика:", r.config.Kafka.OutboxTopic)
+
+	ticker := time.NewTicker(r.config.Kafka.OutboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Публикуем пачками, пока в outbox есть события
+		for {
+			sent, err := r.repo.RelayOutbox(ctx, r.config.Kafka.OutboxBatchSize, r.publish)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Ошибка публикации событий из outbox: %v", err)
+				}
+				break
+			}
+			if sent > 0 {
+				log.Printf("Опубликовано событий из outbox: %d", sent)
+			}
+			if sent < r.config.Kafka.OutboxBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Остановка outbox relay")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish публикует пачку событий одним вызовом, сохраняя их порядок
+func (r *OutboxRelay) publish(events []model.OutboxEvent) error {
+	messages := make([]kafka.Message, len(events))
+	for i, event := range events {
+		messages[i] = kafka.Message{
+			Key:   []byte(event.AggregateID),
+			Value: event.Payload,
+			Headers: []kafka.Header{
+				{Key: headerEventType, Value: []byte(event.EventType)},
+				{Key: headerEventID, Value: []byte(strconv.FormatInt(event.ID, 10))},
+				{Key: headerProducedAt, Value: []byte(event.CreatedAt.UTC().Format(time.RFC3339Nano))},
+			},
+		}
+	}
+
+	// Публикация не прерывается отменой контекста relay, чтобы не оставить пачку частично отправленной
+	ctx, cancel := context.WithTimeout(context.Background(), commitTimeout)
+	defer cancel()
+
+	return r.producer.PublishMessages(ctx, messages...)
+}
+
+// Close закрывает соединение с Kafka
+func (r *OutboxRelay) Close() error {
+	return r.producer.Close()
+}
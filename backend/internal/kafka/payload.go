@@ -0,0 +1,127 @@
+package kafka
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// orderPayload формат заказа в сообщении Kafka (текущая версия схемы).
+// В отличие от model.Order не содержит внутренних идентификаторов и служебных полей БД
+type orderPayload struct {
+	OrderUID          string          `json:"order_uid"`
+	TrackNumber       string          `json:"track_number"`
+	Entry             string          `json:"entry"`
+	Delivery          deliveryPayload `json:"delivery"`
+	Payment           paymentPayload  `json:"payment"`
+	Items             []itemPayload   `json:"items"`
+	Locale            string          `json:"locale"`
+	InternalSignature string          `json:"internal_signature"`
+	CustomerID        string          `json:"customer_id"`
+	DeliveryService   string          `json:"delivery_service"`
+	Shardkey          string          `json:"shardkey"`
+	SmID              int             `json:"sm_id"`
+	DateCreated       time.Time       `json:"date_created"`
+	OofShard          string          `json:"oof_shard"`
+}
+
+type deliveryPayload struct {
+	Name    string `json:"name"`
+	Phone   string `json:"phone"`
+	Zip     string `json:"zip"`
+	City    string `json:"city"`
+	Address string `json:"address"`
+	Region  string `json:"region"`
+	Email   string `json:"email"`
+}
+
+type paymentPayload struct {
+	Transaction  string       `json:"transaction"`
+	RequestID    string       `json:"request_id"`
+	Currency     string       `json:"currency"`
+	Provider     string       `json:"provider"`
+	Amount       model.Amount `json:"amount"`
+	PaymentDt    int64        `json:"payment_dt"`
+	Bank         string       `json:"bank"`
+	DeliveryCost model.Amount `json:"delivery_cost"`
+	GoodsTotal   model.Amount `json:"goods_total"`
+	CustomFee    model.Amount `json:"custom_fee"`
+}
+
+type itemPayload struct {
+	ChrtID      int          `json:"chrt_id"`
+	TrackNumber string       `json:"track_number"`
+	Price       model.Amount `json:"price"`
+	RID         string       `json:"rid"`
+	Name        string       `json:"name"`
+	Sale        int          `json:"sale"`
+	Size        string       `json:"size"`
+	TotalPrice  model.Amount `json:"total_price"`
+	NmID        int          `json:"nm_id"`
+	Brand       string       `json:"brand"`
+	Status      int          `json:"status"`
+}
+
+// EncodeOrder сериализует заказ в формат сообщения Kafka текущей версии схемы
+func EncodeOrder(order *model.Order) ([]byte, error) {
+	payload := orderPayload{
+		OrderUID:          order.OrderUID,
+		TrackNumber:       order.TrackNumber,
+		Entry:             order.Entry,
+		Locale:            order.Locale,
+		InternalSignature: order.InternalSignature,
+		CustomerID:        order.CustomerID,
+		DeliveryService:   order.DeliveryService,
+		Shardkey:          order.Shardkey,
+		SmID:              order.SmID,
+		DateCreated:       order.DateCreated,
+		OofShard:          order.OofShard,
+		Items:             make([]itemPayload, 0, len(order.Items)),
+	}
+
+	if order.Delivery != nil {
+		payload.Delivery = deliveryPayload{
+			Name:    order.Delivery.Name,
+			Phone:   order.Delivery.Phone,
+			Zip:     order.Delivery.Zip,
+			City:    order.Delivery.City,
+			Address: order.Delivery.Address,
+			Region:  order.Delivery.Region,
+			Email:   order.Delivery.Email,
+		}
+	}
+
+	if order.Payment != nil {
+		payload.Payment = paymentPayload{
+			Transaction:  order.Payment.Transaction,
+			RequestID:    order.Payment.RequestID,
+			Currency:     order.Payment.Currency,
+			Provider:     order.Payment.Provider,
+			Amount:       order.Payment.Amount,
+			PaymentDt:    order.Payment.PaymentDt,
+			Bank:         order.Payment.Bank,
+			DeliveryCost: order.Payment.DeliveryCost,
+			GoodsTotal:   order.Payment.GoodsTotal,
+			CustomFee:    order.Payment.CustomFee,
+		}
+	}
+
+	for _, item := range order.Items {
+		payload.Items = append(payload.Items, itemPayload{
+			ChrtID:      item.ChrtID,
+			TrackNumber: item.TrackNumber,
+			Price:       item.Price,
+			RID:         item.RID,
+			Name:        item.Name,
+			Sale:        item.Sale,
+			Size:        item.Size,
+			TotalPrice:  item.TotalPrice,
+			NmID:        item.NmID,
+			Brand:       item.Brand,
+			Status:      item.Status,
+		})
+	}
+
+	return json.Marshal(payload)
+}
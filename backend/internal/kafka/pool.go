@@ -0,0 +1,228 @@
+package kafka
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// commitTimeout ограничивает время фиксации offset'ов, в том числе при остановке consumer'а
+const commitTimeout = 10 * time.Second
+
+// batchHandlerFunc обрабатывает пачку сообщений и возвращает результат для каждого из них,
+// nil означает, что offset сообщения можно фиксировать
+type batchHandlerFunc func(ctx context.Context, messages []kafka.Message) []error
+
+// workerPool распределяет сообщения по воркерам по хэшу ключа (order_uid).
+// Сообщения с одинаковым ключом всегда попадают в один воркер и обрабатываются по порядку,
+// сообщения разных заказов обрабатываются параллельно
+type workerPool struct {
+	queues  []chan kafka.Message
+	handler batchHandlerFunc
+	events  chan<- commitEvent
+	wg      sync.WaitGroup
+
+	// batchSize максимальный размер пачки; при значении <= 1 сообщения обрабатываются по одному
+	batchSize int
+	// batchTimeout максимальное время ожидания заполнения пачки
+	batchTimeout time.Duration
+}
+
+// newWorkerPool создает пул из workers воркеров с очередью queueSize у каждого
+func newWorkerPool(workers, queueSize int, handler batchHandlerFunc, events chan<- commitEvent) *workerPool {
+	queues := make([]chan kafka.Message, workers)
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, queueSize)
+	}
+
+	return &workerPool{
+		queues:  queues,
+		handler: handler,
+		events:  events,
+	}
+}
+
+// start запускает воркеры
+func (p *workerPool) start(ctx context.Context) {
+	for i, queue := range p.queues {
+		p.wg.Add(1)
+		go func(id int, queue <-chan kafka.Message) {
+			defer p.wg.Done()
+			for {
+				batch, ok := p.nextBatch(queue)
+				if len(batch) > 0 {
+					results := p.handler(ctx, batch)
+					for j, message := range batch {
+						p.events <- commitEvent{message: message, processed: true, err: results[j]}
+					}
+				}
+				if !ok {
+					break
+				}
+			}
+			log.Printf("Воркер %d остановлен", id)
+		}(i, queue)
+	}
+}
+
+// nextBatch собирает из очереди до batchSize сообщений, ожидая не дольше batchTimeout
+// после первого сообщения. ok == false означает, что очередь закрыта
+func (p *workerPool) nextBatch(queue <-chan kafka.Message) ([]kafka.Message, bool) {
+	message, ok := <-queue
+	if !ok {
+		return nil, false
+	}
+
+	batch := []kafka.Message{message}
+	if p.batchSize <= 1 {
+		return batch, true
+	}
+
+	timer := time.NewTimer(p.batchTimeout)
+	defer timer.Stop()
+
+	for len(batch) < p.batchSize {
+		select {
+		case message, ok = <-queue:
+			if !ok {
+				return batch, false
+			}
+			batch = append(batch, message)
+		case <-timer.C:
+			return batch, true
+		}
+	}
+
+	return batch, true
+}
+
+// dispatch отправляет сообщение воркеру, отвечающему за его ключ
+func (p *workerPool) dispatch(ctx context.Context, message kafka.Message) error {
+	queue := p.queues[p.workerFor(message)]
+
+	select {
+	case queue <- message:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// workerFor выбирает воркер по ключу сообщения; сообщения без ключа распределяются по партиции,
+// чтобы сохранить порядок внутри нее
+func (p *workerPool) workerFor(message kafka.Message) int {
+	key := message.Key
+	if len(key) == 0 {
+		key = []byte(strconv.Itoa(message.Partition))
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// stop закрывает очереди и дожидается завершения воркеров
+func (p *workerPool) stop() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
+
+// commitEvent событие для offsetCommitter: либо новое прочитанное сообщение,
+// либо результат обработки ранее прочитанного
+type commitEvent struct {
+	message   kafka.Message
+	processed bool
+	err       error
+}
+
+// partitionOffsets хранит прочитанные, но еще не зафиксированные offset'ы партиции
+type partitionOffsets struct {
+	pending  []kafka.Message
+	finished map[int64]bool
+}
+
+// offsetCommitter фиксирует offset'ы строго по порядку внутри каждой партиции:
+// offset фиксируется только когда обработаны все предшествующие ему сообщения партиции.
+// Все состояние принадлежит одной горутине, поэтому коммиты не переупорядочиваются
+type offsetCommitter struct {
+	reader     messageReader
+	events     chan commitEvent
+	partitions map[int]*partitionOffsets
+	done       chan struct{}
+}
+
+// newOffsetCommitter создает committer с буфером событий bufferSize
+func newOffsetCommitter(reader messageReader, bufferSize int) *offsetCommitter {
+	return &offsetCommitter{
+		reader:     reader,
+		events:     make(chan commitEvent, bufferSize),
+		partitions: make(map[int]*partitionOffsets),
+		done:       make(chan struct{}),
+	}
+}
+
+// track регистрирует прочитанное сообщение; должен вызываться до передачи сообщения воркеру
+func (oc *offsetCommitter) track(message kafka.Message) {
+	oc.events <- commitEvent{message: message}
+}
+
+// run обрабатывает события до закрытия канала events
+func (oc *offsetCommitter) run() {
+	defer close(oc.done)
+
+	for event := range oc.events {
+		partition, ok := oc.partitions[event.message.Partition]
+		if !ok {
+			partition = &partitionOffsets{finished: make(map[int64]bool)}
+			oc.partitions[event.message.Partition] = partition
+		}
+
+		if !event.processed {
+			partition.pending = append(partition.pending, event.message)
+			continue
+		}
+
+		// Необработанное сообщение остается в pending и блокирует фиксацию следующих за ним offset'ов
+		if event.err != nil {
+			continue
+		}
+		partition.finished[event.message.Offset] = true
+
+		var last *kafka.Message
+		for len(partition.pending) > 0 && partition.finished[partition.pending[0].Offset] {
+			head := partition.pending[0]
+			delete(partition.finished, head.Offset)
+			partition.pending = partition.pending[1:]
+			last = &head
+		}
+
+		if last != nil {
+			oc.commit(*last)
+		}
+	}
+}
+
+// commit фиксирует offset сообщения; контекст не зависит от контекста consumer'а,
+// чтобы успеть зафиксировать уже обработанные сообщения при остановке
+func (oc *offsetCommitter) commit(message kafka.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), commitTimeout)
+	defer cancel()
+
+	if err := oc.reader.CommitMessages(ctx, message); err != nil {
+		log.Printf("Ошибка фиксации offset'а: offset=%d, partition=%d: %v",
+			message.Offset, message.Partition, err)
+	}
+}
+
+// stop дожидается обработки всех событий
+func (oc *offsetCommitter) stop() {
+	close(oc.events)
+	<-oc.done
+}
@@ -0,0 +1,97 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/makhkets/wildberries-l0/internal/config"
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+type Producer interface {
+	// Publish публикует произвольное сообщение в топик заказов
+	Publish(ctx context.Context, key, value []byte, headers ...kafka.Header) error
+	// PublishMessages публикует несколько сообщений одним вызовом с сохранением порядка
+	PublishMessages(ctx context.Context, messages ...kafka.Message) error
+	// PublishOrder публикует заказ с ключом order_uid и метаданными конверта в заголовках
+	PublishOrder(ctx context.Context, order *model.Order, eventType, eventID string) error
+	Close() error
+}
+
+type producer struct {
+	writer messageWriter
+}
+
+// NewProducer создает Kafka producer для топика заказов из конфигурации
+func NewProducer(cfg *config.Config) Producer {
+	return NewTopicProducer(cfg.Kafka.Brokers, cfg.Kafka.Topic)
+}
+
+// NewTopicProducer создает Kafka producer для указанного топика.
+// Сообщения с одинаковым ключом попадают в одну партицию
+func NewTopicProducer(brokers []string, topic string) Producer {
+	writer := &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Topic:                  topic,
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+		BatchTimeout:           10 * time.Millisecond,
+	}
+
+	return &producer{writer: writer}
+}
+
+// Publish публикует произвольное сообщение
+func (p *producer) Publish(ctx context.Context, key, value []byte, headers ...kafka.Header) error {
+	message := kafka.Message{
+		Key:     key,
+		Value:   value,
+		Headers: headers,
+	}
+
+	if err := p.writer.WriteMessages(ctx, message); err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	return nil
+}
+
+// PublishMessages публикует несколько сообщений; сообщения одного ключа попадают в одну партицию
+// в порядке передачи
+func (p *producer) PublishMessages(ctx context.Context, messages ...kafka.Message) error {
+	if err := p.writer.WriteMessages(ctx, messages...); err != nil {
+		return fmt.Errorf("failed to publish %d messages: %w", len(messages), err)
+	}
+
+	return nil
+}
+
+// PublishOrder сериализует заказ и публикует его с заголовками конверта текущей версии схемы
+func (p *producer) PublishOrder(ctx context.Context, order *model.Order, eventType, eventID string) error {
+	value, err := EncodeOrder(order)
+	if err != nil {
+		return fmt.Errorf("failed to marshal order %s: %w", order.OrderUID, err)
+	}
+
+	return p.Publish(ctx, []byte(order.OrderUID), value, EnvelopeHeaders(eventType, eventID)...)
+}
+
+// EnvelopeHeaders заголовки конверта текущей версии схемы заказа
+func EnvelopeHeaders(eventType, eventID string) []kafka.Header {
+	return []kafka.Header{
+		{Key: headerSchemaVersion, Value: []byte(strconv.Itoa(orderSchemaVersion))},
+		{Key: headerEventType, Value: []byte(eventType)},
+		{Key: headerEventID, Value: []byte(eventID)},
+		{Key: headerProducedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+	}
+}
+
+// Close закрывает соединение с Kafka
+func (p *producer) Close() error {
+	return p.writer.Close()
+}
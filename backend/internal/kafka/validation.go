@@ -0,0 +1,242 @@
+package kafka
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	errors2 "github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+	"github.com/makhkets/wildberries-l0/internal/service"
+)
+
+// orderSchemaVersion текущая версия JSON Schema сообщения заказа
+const orderSchemaVersion = 1
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// Этапы проверки сообщения
+const (
+	stageDecode     = "decode"
+	stageSchema     = "schema"
+	stageValidation = "validation"
+)
+
+// FieldViolation нарушение, относящееся к конкретному полю сообщения
+type FieldViolation struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// RejectionError сообщение отклонено при разборе или проверке.
+// Содержит причины по полям, чтобы их можно было передать в DLQ или отчет
+type RejectionError struct {
+	Stage         string           `json:"stage"`
+	SchemaVersion int              `json:"schema_version"`
+	Violations    []FieldViolation `json:"violations"`
+}
+
+// Error реализует интерфейс error
+func (e *RejectionError) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, fmt.Sprintf("%s: %s", v.Field, v.Reason))
+	}
+	return fmt.Sprintf("message rejected at %s stage: %s", e.Stage, strings.Join(parts, "; "))
+}
+
+// Unwrap позволяет считать отклоненное сообщение некорректным (без повторов обработки)
+func (e *RejectionError) Unwrap() error {
+	return errMalformedMessage
+}
+
+// orderValidator проверяет сообщения по JSON Schema, строго декодирует их
+// и применяет бизнес-валидацию сервиса заказов
+type orderValidator struct {
+	schemas      map[int]*jsonschema.Schema
+	orderService service.Order
+}
+
+// mustNewOrderValidator компилирует встроенные схемы; ошибка означает некорректную схему в сборке
+func mustNewOrderValidator(orderService service.Order) *orderValidator {
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+
+	schemas := make(map[int]*jsonschema.Schema)
+	for _, version := range []int{orderSchemaVersion} {
+		name := fmt.Sprintf("schemas/order.v%d.json", version)
+
+		data, err := schemaFiles.ReadFile(name)
+		if err != nil {
+			panic(fmt.Errorf("failed to read order schema %s: %w", name, err))
+		}
+		if err = compiler.AddResource(name, bytes.NewReader(data)); err != nil {
+			panic(fmt.Errorf("failed to add order schema %s: %w", name, err))
+		}
+
+		schema, err := compiler.Compile(name)
+		if err != nil {
+			panic(fmt.Errorf("failed to compile order schema %s: %w", name, err))
+		}
+		schemas[version] = schema
+	}
+
+	return &orderValidator{
+		schemas:      schemas,
+		orderService: orderService,
+	}
+}
+
+// decode проверяет payload текущей версии схемы и возвращает заказ.
+// При любой ошибке возвращает *RejectionError с перечнем нарушений по полям
+func (v *orderValidator) decode(payload []byte) (*model.Order, error) {
+	// Проверка по JSON Schema
+	var raw interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, rejectDecode(err)
+	}
+	if err := ensureEOF(decoder); err != nil {
+		return nil, rejectDecode(err)
+	}
+
+	if err := v.schemas[orderSchemaVersion].Validate(raw); err != nil {
+		return nil, rejectSchema(err)
+	}
+
+	// Строгое декодирование: неизвестные поля и неверные типы запрещены
+	var order model.Order
+	decoder = json.NewDecoder(bytes.NewReader(payload))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&order); err != nil {
+		return nil, rejectDecode(err)
+	}
+
+	// Бизнес-валидация сервиса заказов
+	if err := v.orderService.ValidateOrder(&order); err != nil {
+		return nil, rejectValidation(err)
+	}
+
+	return &order, nil
+}
+
+// ensureEOF проверяет, что после JSON-документа нет лишних данных
+func ensureEOF(decoder *json.Decoder) error {
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("unexpected data after JSON document")
+	}
+	return nil
+}
+
+// rejectDecode формирует отказ по ошибке декодирования JSON
+func rejectDecode(err error) *RejectionError {
+	violation := FieldViolation{Field: "$", Reason: err.Error()}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		violation = FieldViolation{
+			Field:  typeErr.Field,
+			Reason: fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value),
+		}
+	}
+
+	// Сообщение об неизвестном поле имеет вид: json: unknown field "name"
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		violation = FieldViolation{Field: strings.Trim(field, `"`), Reason: "unknown field"}
+	}
+
+	return &RejectionError{
+		Stage:         stageDecode,
+		SchemaVersion: orderSchemaVersion,
+		Violations:    []FieldViolation{violation},
+	}
+}
+
+// rejectSchema формирует отказ по ошибкам JSON Schema (по одному нарушению на каждую конечную причину)
+func rejectSchema(err error) *RejectionError {
+	rejection := &RejectionError{Stage: stageSchema, SchemaVersion: orderSchemaVersion}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		rejection.Violations = []FieldViolation{{Field: "$", Reason: err.Error()}}
+		return rejection
+	}
+
+	var collect func(e *jsonschema.ValidationError)
+	collect = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			rejection.Violations = append(rejection.Violations, FieldViolation{
+				Field:  pointerToField(e.InstanceLocation),
+				Reason: e.Message,
+			})
+			return
+		}
+		for _, cause := range e.Causes {
+			collect(cause)
+		}
+	}
+	collect(validationErr)
+
+	return rejection
+}
+
+// rejectValidation формирует отказ по ошибке бизнес-валидации
+func rejectValidation(err error) *RejectionError {
+	violation := FieldViolation{Field: "$", Reason: err.Error()}
+
+	var appErr *errors2.AppError
+	if errors2.IsAppError(err, &appErr) && appErr.Field != "" {
+		violation = FieldViolation{
+			Field:  appErr.Field,
+			Reason: strings.TrimPrefix(appErr.Details, fmt.Sprintf("Field '%s': ", appErr.Field)),
+		}
+	}
+
+	return &RejectionError{
+		Stage:         stageValidation,
+		SchemaVersion: orderSchemaVersion,
+		Violations:    []FieldViolation{violation},
+	}
+}
+
+// pointerToField преобразует JSON Pointer (/items/0/price) в путь поля (items[0].price)
+func pointerToField(pointer string) string {
+	if pointer == "" {
+		return "$"
+	}
+
+	var b strings.Builder
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		if isIndex(token) {
+			b.WriteString("[" + token + "]")
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(token)
+	}
+	return b.String()
+}
+
+// isIndex проверяет, является ли токен JSON Pointer индексом массива
+func isIndex(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, r := range token {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
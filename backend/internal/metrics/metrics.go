@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "orders"
+
+// Метрики Kafka consumer'а
+var (
+	KafkaMessagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "messages_consumed_total",
+		Help:      "Number of messages fetched from Kafka.",
+	}, []string{"topic"})
+
+	KafkaMessagesSucceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "messages_succeeded_total",
+		Help:      "Number of messages processed successfully.",
+	}, []string{"topic"})
+
+	KafkaMessagesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "messages_failed_total",
+		Help:      "Number of messages that failed processing after all retries.",
+	}, []string{"topic"})
+
+	KafkaMessagesDLQ = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "messages_dlq_total",
+		Help:      "Number of messages published to the dead-letter topic.",
+	}, []string{"topic"})
+
+	KafkaMessagesDuplicate = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "messages_duplicate_total",
+		Help:      "Number of already processed messages that were skipped.",
+	}, []string{"topic"})
+
+	KafkaProcessingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "message_processing_duration_seconds",
+		Help:      "Time spent processing a message, including retries.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+	}, []string{"topic"})
+
+	KafkaPartitionLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "partition_lag",
+		Help:      "Number of messages between the last fetched offset and the partition high watermark.",
+	}, []string{"topic", "partition"})
+
+	KafkaReaderLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "reader_lag",
+		Help:      "Consumer lag across all assigned partitions reported by the Kafka reader stats.",
+	}, []string{"topic"})
+)
+
+// Метрики HTTP API
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests by route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// Метрики кэша заказов
+var (
+	CacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "lookups_total",
+		Help:      "Number of order cache lookups by tier (l1, redis) and result (hit, miss).",
+	}, []string{"tier", "result"})
+
+	CacheInvalidations = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "l1_invalidations_total",
+		Help:      "Number of in-process cache entries invalidated by other instances.",
+	})
+)
+
+// Handler возвращает HTTP handler, отдающий метрики в текстовом формате Prometheus
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
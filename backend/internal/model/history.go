@@ -0,0 +1,32 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Источники изменений заказа
+const (
+	ChangeSourceKafka = "kafka"
+	ChangeSourceHTTP  = "http"
+)
+
+// OrderHistoryEntry снимок заказа после одного изменения
+type OrderHistoryEntry struct {
+	ID        int64  `json:"id" db:"id"`
+	OrderUID  string `json:"order_uid" db:"order_uid"`
+	Version   int    `json:"version" db:"version"`
+	EventType string `json:"event_type" db:"event_type"`
+	Source    string `json:"source" db:"source"`
+
+	// Положение сообщения Kafka (для source = kafka)
+	KafkaTopic     string `json:"kafka_topic,omitempty" db:"kafka_topic"`
+	KafkaPartition *int   `json:"kafka_partition,omitempty" db:"kafka_partition"`
+	KafkaOffset    *int64 `json:"kafka_offset,omitempty" db:"kafka_offset"`
+
+	// Идентификатор HTTP запроса (для source = http)
+	RequestID string `json:"request_id,omitempty" db:"request_id"`
+
+	Snapshot  json.RawMessage `json:"snapshot" db:"snapshot"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
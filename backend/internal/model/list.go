@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// OrderCursor позиция в списке заказов, отсортированном по (created_at, id) по убыванию
+type OrderCursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+// OrderFilter фильтры и параметры страницы списка заказов. Пустые поля не фильтруют
+type OrderFilter struct {
+	CustomerID      string
+	TrackNumber     string
+	DeliveryService string
+	Currency        string
+	Provider        string
+	Brand           string
+	NmID            int
+
+	// Диапазон date_created: [DateFrom, DateTo)
+	DateFrom *time.Time
+	DateTo   *time.Time
+
+	// After курсор последнего заказа предыдущей страницы
+	After *OrderCursor
+	Limit int
+}
+
+// OrderPage страница списка заказов
+type OrderPage struct {
+	Orders     []*Order `json:"orders"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
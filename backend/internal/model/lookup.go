@@ -0,0 +1,34 @@
+package model
+
+// LookupKey вторичный ключ, по которому можно найти заказ
+type LookupKey string
+
+const (
+	LookupTrackNumber LookupKey = "track"
+	LookupTransaction LookupKey = "transaction"
+	LookupRID         LookupKey = "rid"
+)
+
+// MatchesLookup проверяет, что заказ содержит значение вторичного ключа
+func (o *Order) MatchesLookup(key LookupKey, value string) bool {
+	switch key {
+	case LookupTrackNumber:
+		if o.TrackNumber == value {
+			return true
+		}
+		for _, item := range o.Items {
+			if item.TrackNumber == value {
+				return true
+			}
+		}
+	case LookupTransaction:
+		return o.Payment != nil && o.Payment.Transaction == value
+	case LookupRID:
+		for _, item := range o.Items {
+			if item.RID == value {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"fmt"
+	"math"
+)
+
+// Amount денежная сумма в минимальных единицах валюты (копейки, центы).
+// Количество минимальных единиц в основной определяет валюта платежа
+type Amount int64
+
+// Money сумма в определенной валюте
+type Money struct {
+	Amount   Amount
+	Currency Currency
+}
+
+// NewMoney создает сумму в минимальных единицах валюты
+func NewMoney(amount Amount, currency Currency) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Add складывает суммы одной валюты; ошибка при разных валютах или переполнении
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("currency mismatch: %s and %s", m.Currency, other.Currency)
+	}
+
+	if (other.Amount > 0 && m.Amount > math.MaxInt64-other.Amount) ||
+		(other.Amount < 0 && m.Amount < math.MinInt64-other.Amount) {
+		return Money{}, fmt.Errorf("amount overflow")
+	}
+
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Equal проверяет равенство сумм с учетом валюты
+func (m Money) Equal(other Money) bool {
+	return m == other
+}
+
+// String форматирует сумму в основных единицах валюты, например "18.17 USD"
+func (m Money) String() string {
+	units, ok := m.Currency.MinorUnits()
+	if !ok || units == 0 {
+		return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+	}
+
+	sign, amount := "", uint64(m.Amount)
+	if m.Amount < 0 {
+		sign, amount = "-", uint64(-m.Amount)
+	}
+
+	scale := uint64(math.Pow10(units))
+
+	return fmt.Sprintf("%s%d.%0*d %s", sign, amount/scale, units, amount%scale, m.Currency)
+}
+
+// Money возвращает сумму платежа в его валюте
+func (p *Payment) Money(amount Amount) Money {
+	return NewMoney(amount, Currency(p.Currency))
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMoneyAdd(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		a, b  Money
+		sum   Amount
+		fails bool
+	}{
+		{name: "same currency", a: NewMoney(1500, "USD"), b: NewMoney(317, "USD"), sum: 1817},
+		{name: "negative amount", a: NewMoney(100, "USD"), b: NewMoney(-250, "USD"), sum: -150},
+		{name: "max amount", a: NewMoney(math.MaxInt64-1, "USD"), b: NewMoney(1, "USD"), sum: math.MaxInt64},
+		{name: "currency mismatch", a: NewMoney(1, "USD"), b: NewMoney(1, "EUR"), fails: true},
+		{name: "overflow", a: NewMoney(math.MaxInt64, "USD"), b: NewMoney(1, "USD"), fails: true},
+		{name: "underflow", a: NewMoney(math.MinInt64, "USD"), b: NewMoney(-1, "USD"), fails: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sum, err := tc.a.Add(tc.b)
+			if tc.fails {
+				if err == nil {
+					t.Fatalf("expected error, got %s", sum)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !sum.Equal(NewMoney(tc.sum, tc.a.Currency)) {
+				t.Fatalf("expected %d %s, got %s", tc.sum, tc.a.Currency, sum)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	for _, tc := range []struct {
+		money Money
+		want  string
+	}{
+		{money: NewMoney(1817, "USD"), want: "18.17 USD"},
+		{money: NewMoney(5, "RUB"), want: "0.05 RUB"},
+		{money: NewMoney(-1817, "EUR"), want: "-18.17 EUR"},
+		{money: NewMoney(1817, "JPY"), want: "1817 JPY"},
+		{money: NewMoney(1817, "KWD"), want: "1.817 KWD"},
+		{money: NewMoney(12345, "CLF"), want: "1.2345 CLF"},
+		{money: NewMoney(math.MinInt64, "USD"), want: "-92233720368547758.08 USD"},
+		// Для неизвестной валюты сумма выводится в минимальных единицах
+		{money: NewMoney(1817, "XYZ"), want: "1817 XYZ"},
+	} {
+		if got := tc.money.String(); got != tc.want {
+			t.Errorf("expected %q, got %q", tc.want, got)
+		}
+	}
+}
+
+func TestCurrencyMinorUnits(t *testing.T) {
+	for _, tc := range []struct {
+		currency Currency
+		units    int
+		known    bool
+	}{
+		{currency: "SEK", units: 2, known: true},
+		{currency: "PLN", units: 2, known: true},
+		{currency: "CZK", units: 2, known: true},
+		{currency: "HKD", units: 2, known: true},
+		{currency: "JPY", units: 0, known: true},
+		{currency: "BHD", units: 3, known: true},
+		{currency: "UYW", units: 4, known: true},
+		{currency: "usd"},
+		{currency: "XAU"},
+		{currency: ""},
+	} {
+		units, known := tc.currency.MinorUnits()
+		if units != tc.units || known != tc.known {
+			t.Errorf("%q: expected (%d, %v), got (%d, %v)", tc.currency, tc.units, tc.known, units, known)
+		}
+	}
+}
@@ -22,11 +22,35 @@ type Order struct {
 	OofShard          string    `json:"oof_shard" db:"oof_shard"`
 	CreatedAt         time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+	// Version увеличивается при каждом изменении заказа (оптимистическая блокировка)
+	Version int `json:"version" db:"version"`
+	// Status изменяется только через переходы жизненного цикла заказа
+	Status OrderStatus `json:"status" db:"status"`
 
 	// Связанные данные
 	Delivery *Delivery `json:"delivery"`
 	Payment  *Payment  `json:"payment"`
 	Items    []Item    `json:"items"`
+
+	// Source сообщение Kafka, из которого получен заказ (не сериализуется)
+	Source *MessageSource `json:"-"`
+	// RequestID идентификатор HTTP запроса, из которого получен заказ (не сериализуется)
+	RequestID string `json:"-"`
+}
+
+// MessageSource положение сообщения Kafka в топике, используется для идемпотентной обработки
+type MessageSource struct {
+	Topic       string
+	Partition   int
+	Offset      int64
+	Key         string
+	ContentHash string
+
+	// Метаданные конверта сообщения
+	SchemaVersion int
+	EventType     string
+	EventID       string
+	ProducedAt    time.Time
 }
 
 // Delivery информация о доставке
@@ -50,12 +74,14 @@ type Payment struct {
 	RequestID    string `json:"request_id" db:"request_id"`
 	Currency     string `json:"currency" db:"currency"`
 	Provider     string `json:"provider" db:"provider"`
-	Amount       int    `json:"amount" db:"amount"`
+	Amount       Amount `json:"amount" db:"amount"`
 	PaymentDt    int64  `json:"payment_dt" db:"payment_dt"`
 	Bank         string `json:"bank" db:"bank"`
-	DeliveryCost int    `json:"delivery_cost" db:"delivery_cost"`
-	GoodsTotal   int    `json:"goods_total" db:"goods_total"`
-	CustomFee    int    `json:"custom_fee" db:"custom_fee"`
+	DeliveryCost Amount `json:"delivery_cost" db:"delivery_cost"`
+	GoodsTotal   Amount `json:"goods_total" db:"goods_total"`
+	CustomFee    Amount `json:"custom_fee" db:"custom_fee"`
+	// Status изменяется только через переходы жизненного цикла платежа
+	Status PaymentStatus `json:"status" db:"status"`
 }
 
 // Item товарная позиция в заказе
@@ -64,12 +90,12 @@ type Item struct {
 	OrderID     int    `json:"order_id" db:"order_id"`
 	ChrtID      int    `json:"chrt_id" db:"chrt_id"`
 	TrackNumber string `json:"track_number" db:"track_number"`
-	Price       int    `json:"price" db:"price"`
+	Price       Amount `json:"price" db:"price"`
 	RID         string `json:"rid" db:"rid"`
 	Name        string `json:"name" db:"name"`
 	Sale        int    `json:"sale" db:"sale"`
 	Size        string `json:"size" db:"size"`
-	TotalPrice  int    `json:"total_price" db:"total_price"`
+	TotalPrice  Amount `json:"total_price" db:"total_price"`
 	NmID        int    `json:"nm_id" db:"nm_id"`
 	Brand       string `json:"brand" db:"brand"`
 	Status      int    `json:"status" db:"status"`
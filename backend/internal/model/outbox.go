@@ -0,0 +1,22 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Типы событий об изменении заказа
+const (
+	EventOrderCreated = "order.created"
+	EventOrderUpdated = "order.updated"
+	EventOrderDeleted = "order.deleted"
+)
+
+// OutboxEvent событие об изменении заказа, ожидающее публикации в Kafka
+type OutboxEvent struct {
+	ID          int64           `json:"id" db:"id"`
+	AggregateID string          `json:"aggregate_id" db:"aggregate_id"`
+	EventType   string          `json:"event_type" db:"event_type"`
+	Payload     json.RawMessage `json:"payload" db:"payload"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// OrderSummary краткие сведения о заказе, найденном поиском
+type OrderSummary struct {
+	OrderUID     string    `json:"order_uid"`
+	TrackNumber  string    `json:"track_number"`
+	CustomerID   string    `json:"customer_id"`
+	CustomerName string    `json:"customer_name"`
+	City         string    `json:"city"`
+	DateCreated  time.Time `json:"date_created"`
+	Amount       Amount    `json:"amount"`
+	Currency     string    `json:"currency"`
+	ItemsCount   int       `json:"items_count"`
+
+	// Rank релевантность заказа запросу
+	Rank float64 `json:"rank"`
+	// Highlights фрагменты с совпадениями, выделенными тегом <mark>
+	Highlights []string `json:"highlights,omitempty"`
+}
+
+// OrderSearchPage страница результатов поиска, отсортированных по релевантности
+type OrderSearchPage struct {
+	Results []OrderSummary `json:"results"`
+	Limit   int            `json:"limit"`
+	Offset  int            `json:"offset"`
+	HasMore bool           `json:"has_more"`
+}
@@ -0,0 +1,153 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Сущности, статус которых изменяется переходами
+const (
+	StatusEntityOrder   = "order"
+	StatusEntityPayment = "payment"
+)
+
+// EventOrderStatusChanged тип события об изменении статуса заказа или платежа
+const EventOrderStatusChanged = "order.status_changed"
+
+var orderStatusNames = map[OrderStatus]string{
+	OrderStatusNew:        "new",
+	OrderStatusProcessing: "processing",
+	OrderStatusShipped:    "shipped",
+	OrderStatusDelivered:  "delivered",
+	OrderStatusCancelled:  "cancelled",
+}
+
+var paymentStatusNames = map[PaymentStatus]string{
+	PaymentStatusPending:   "pending",
+	PaymentStatusCompleted: "completed",
+	PaymentStatusFailed:    "failed",
+	PaymentStatusRefunded:  "refunded",
+}
+
+// String возвращает название статуса заказа
+func (s OrderStatus) String() string {
+	if name, ok := orderStatusNames[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// String возвращает название статуса платежа
+func (s PaymentStatus) String() string {
+	if name, ok := paymentStatusNames[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseOrderStatus возвращает статус заказа по названию
+func ParseOrderStatus(name string) (OrderStatus, bool) {
+	for status, statusName := range orderStatusNames {
+		if statusName == name {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
+// ParsePaymentStatus возвращает статус платежа по названию
+func ParsePaymentStatus(name string) (PaymentStatus, bool) {
+	for status, statusName := range paymentStatusNames {
+		if statusName == name {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
+// MarshalJSON сериализует статус заказа названием
+func (s OrderStatus) MarshalJSON() ([]byte, error) {
+	return marshalStatus(int(s), orderStatusNames[s])
+}
+
+// UnmarshalJSON принимает название статуса заказа или его номер
+// (в таком виде статус сохранялся в кэше, истории и outbox раньше)
+func (s *OrderStatus) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	value, err := unmarshalStatus(data, func(name string) (int, bool) {
+		status, ok := ParseOrderStatus(name)
+		return int(status), ok
+	})
+	if err != nil {
+		return fmt.Errorf("invalid order status: %w", err)
+	}
+
+	*s = OrderStatus(value)
+	return nil
+}
+
+// MarshalJSON сериализует статус платежа названием
+func (s PaymentStatus) MarshalJSON() ([]byte, error) {
+	return marshalStatus(int(s), paymentStatusNames[s])
+}
+
+// UnmarshalJSON принимает название статуса платежа или его номер
+func (s *PaymentStatus) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	value, err := unmarshalStatus(data, func(name string) (int, bool) {
+		status, ok := ParsePaymentStatus(name)
+		return int(status), ok
+	})
+	if err != nil {
+		return fmt.Errorf("invalid payment status: %w", err)
+	}
+
+	*s = PaymentStatus(value)
+	return nil
+}
+
+// marshalStatus сериализует статус названием; незаданный статус - null,
+// статус без названия - номером, чтобы значение не терялось
+func marshalStatus(value int, name string) ([]byte, error) {
+	switch {
+	case name != "":
+		return json.Marshal(name)
+	case value == 0:
+		return []byte("null"), nil
+	default:
+		return json.Marshal(value)
+	}
+}
+
+// unmarshalStatus разбирает статус, заданный названием (через parse) или номером
+func unmarshalStatus(data []byte, parse func(name string) (int, bool)) (int, error) {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		value, ok := parse(name)
+		if !ok {
+			return 0, fmt.Errorf("unknown status %q", name)
+		}
+		return value, nil
+	}
+
+	var value int
+	if err := json.Unmarshal(data, &value); err != nil {
+		return 0, errors.New("must be a status name or number")
+	}
+	return value, nil
+}
+
+// StatusChange запрошенное изменение статусов заказа. Пустые поля не изменяются
+type StatusChange struct {
+	OrderStatus   *OrderStatus
+	PaymentStatus *PaymentStatus
+	RequestID     string
+}
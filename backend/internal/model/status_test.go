@@ -0,0 +1,52 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestStatusJSON(t *testing.T) {
+	order := Order{Status: OrderStatusShipped, Payment: &Payment{Status: PaymentStatusRefunded}}
+
+	data, err := json.Marshal(order)
+	if err != nil {
+		t.Fatalf("marshal order: %v", err)
+	}
+
+	var fields struct {
+		Status  json.RawMessage `json:"status"`
+		Payment struct {
+			Status json.RawMessage `json:"status"`
+		} `json:"payment"`
+	}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("unmarshal fields: %v", err)
+	}
+	if string(fields.Status) != `"shipped"` || string(fields.Payment.Status) != `"refunded"` {
+		t.Fatalf("statuses must be serialized by name, got %s and %s", fields.Status, fields.Payment.Status)
+	}
+
+	var decoded Order
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal order: %v", err)
+	}
+	if decoded.Status != OrderStatusShipped || decoded.Payment.Status != PaymentStatusRefunded {
+		t.Fatalf("statuses lost in round trip: %v, %v", decoded.Status, decoded.Payment.Status)
+	}
+
+	// Ранее сохраненные данные содержат номера статусов
+	if err = json.Unmarshal([]byte(`{"status":4,"payment":{"status":2}}`), &decoded); err != nil {
+		t.Fatalf("unmarshal numeric statuses: %v", err)
+	}
+	if decoded.Status != OrderStatusDelivered || decoded.Payment.Status != PaymentStatusCompleted {
+		t.Fatalf("numeric statuses decoded as %v, %v", decoded.Status, decoded.Payment.Status)
+	}
+
+	if err = json.Unmarshal([]byte(`{"status":"lost"}`), &decoded); err == nil {
+		t.Fatal("expected error for unknown status name")
+	}
+
+	if data, _ = json.Marshal(Order{}); !json.Valid(data) {
+		t.Fatalf("order without status must marshal to valid JSON, got %s", data)
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// Ограничения размера страницы списка заказов
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// ListOrders возвращает страницу заказов по фильтру. cursor - значение next_cursor
+// предыдущей страницы (пустая строка для первой страницы)
+func (s *OrderService) ListOrders(ctx context.Context, filter model.OrderFilter, cursor string) (*model.OrderPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultPageLimit
+	}
+	if filter.Limit > maxPageLimit {
+		return nil, errors.NewValidationError("limit", fmt.Sprintf("must not exceed %d", maxPageLimit))
+	}
+	if filter.DateFrom != nil && filter.DateTo != nil && !filter.DateFrom.Before(*filter.DateTo) {
+		return nil, errors.NewValidationError("date_from", "must be before date_to")
+	}
+
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = after
+	}
+
+	// Запрашиваем на один заказ больше, чтобы понять, есть ли следующая страница
+	limit := filter.Limit
+	filter.Limit++
+
+	orders, err := s.repo.ListOrders(ctx, filter)
+	if err != nil {
+		slog.Error("Failed to list orders from repository", "error", err)
+		return nil, errors.NewAppError(errors.ErrorTypeInternal, "Failed to list orders")
+	}
+
+	page := &model.OrderPage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor = encodeCursor(model.OrderCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	return page, nil
+}
+
+// encodeCursor кодирует позицию заказа в непрозрачную строку
+func encodeCursor(cursor model.OrderCursor) string {
+	raw := fmt.Sprintf("%d:%d", cursor.CreatedAt.UnixMicro(), cursor.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor разбирает строку, полученную из encodeCursor
+func decodeCursor(value string) (*model.OrderCursor, error) {
+	invalid := errors.NewValidationError("cursor", "invalid cursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, invalid
+	}
+
+	micros, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, invalid
+	}
+
+	createdAt, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return nil, invalid
+	}
+
+	orderID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, invalid
+	}
+
+	return &model.OrderCursor{
+		CreatedAt: time.UnixMicro(createdAt).UTC(),
+		ID:        orderID,
+	}, nil
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+	"github.com/makhkets/wildberries-l0/pkg/lib/logger/sl"
+)
+
+// GetOrderByTrackNumber получает заказ по трек-номеру заказа или товарной позиции
+func (s *OrderService) GetOrderByTrackNumber(ctx context.Context, trackNumber string) (*model.Order, error) {
+	return s.getOrderByLookup(ctx, model.LookupTrackNumber, trackNumber, s.repo.GetOrderByTrackNumber)
+}
+
+// GetOrderByTransaction получает заказ по идентификатору транзакции платежа
+func (s *OrderService) GetOrderByTransaction(ctx context.Context, transaction string) (*model.Order, error) {
+	return s.getOrderByLookup(ctx, model.LookupTransaction, transaction, s.repo.GetOrderByTransaction)
+}
+
+// GetOrderByRID получает заказ по rid товарной позиции
+func (s *OrderService) GetOrderByRID(ctx context.Context, rid string) (*model.Order, error) {
+	return s.getOrderByLookup(ctx, model.LookupRID, rid, s.repo.GetOrderByRID)
+}
+
+// getOrderByLookup ищет заказ по вторичному ключу: сначала через запись "ключ -> order_uid"
+// и заказ в кэше, затем в базе с помощью load. Найденный в базе заказ кэшируется вместе с ключом
+func (s *OrderService) getOrderByLookup(
+	ctx context.Context,
+	key model.LookupKey,
+	value string,
+	load func(ctx context.Context, value string) (*model.Order, error),
+) (*model.Order, error) {
+	if value == "" {
+		return nil, errors.NewValidationError(string(key), "cannot be empty")
+	}
+	if len(value) > 255 {
+		return nil, errors.NewValidationError(string(key), "must not exceed 255 characters")
+	}
+
+	// Запись в кэше могла устареть, если заказ изменился, поэтому проверяем совпадение ключа
+	if uid, ok := s.cache.GetOrderUIDByLookup(ctx, key, value); ok {
+		if order := s.cache.GetOrder(ctx, uid); order != nil && order.MatchesLookup(key, value) {
+			slog.Info("Order retrieved from cache by lookup key", "key", key, "uid", uid)
+			return order, nil
+		}
+	}
+
+	order, err := load(ctx, value)
+	if err != nil {
+		if errors.IsErrorType(err, errors.ErrorTypeNotFound) {
+			return nil, err
+		}
+
+		slog.Error("Failed to get order by lookup key from repository", "key", key, sl.Err(err))
+		return nil, errors.NewAppError(errors.ErrorTypeInternal, "Failed to retrieve order")
+	}
+
+	if err = s.addOrderToCache(ctx, order); err != nil {
+		slog.Warn("Failed to cache order after lookup", "uid", order.OrderUID, "error", err)
+	}
+	if err = s.cache.SetOrderLookup(ctx, key, value, order.OrderUID); err != nil {
+		slog.Warn("Failed to cache order lookup key", "key", key, "uid", order.OrderUID, sl.Err(err))
+	}
+
+	return order, nil
+}
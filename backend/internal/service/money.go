@@ -0,0 +1,75 @@
+package service
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// validateItemPrice проверяет, что total_price согласован с price и скидкой sale:
+// допускается округление цены со скидкой до минимальной единицы валюты в любую сторону
+func validateItemPrice(item *model.Item, index int) error {
+	if item.Sale < 0 || item.Sale > 100 {
+		return errors.NewValidationError(fmt.Sprintf("items[%d].sale", index), "must be between 0 and 100")
+	}
+
+	if item.TotalPrice < 0 {
+		return errors.NewValidationError(fmt.Sprintf("items[%d].total_price", index), "cannot be negative")
+	}
+
+	if item.Price > math.MaxInt64/100 {
+		return errors.NewValidationError(fmt.Sprintf("items[%d].price", index), "is too large")
+	}
+
+	if item.TotalPrice > item.Price {
+		return errors.NewValidationError(fmt.Sprintf("items[%d].total_price", index), "cannot exceed price")
+	}
+
+	// Цена со скидкой в сотых долях минимальной единицы
+	discounted := item.Price * model.Amount(100-item.Sale)
+	if diff := item.TotalPrice*100 - discounted; diff <= -100 || diff >= 100 {
+		return errors.NewValidationError(fmt.Sprintf("items[%d].total_price", index),
+			fmt.Sprintf("does not match price %d with sale %d%%", item.Price, item.Sale))
+	}
+
+	return nil
+}
+
+// validateTotals проверяет согласованность сумм платежа с товарами заказа:
+// goods_total равен сумме total_price, amount равен goods_total + delivery_cost + custom_fee
+func validateTotals(order *model.Order) error {
+	payment := order.Payment
+	if payment == nil || payment.Transaction == "" {
+		return nil
+	}
+
+	goodsTotal := payment.Money(0)
+	for _, item := range order.Items {
+		var err error
+		if goodsTotal, err = goodsTotal.Add(payment.Money(item.TotalPrice)); err != nil {
+			return errors.NewValidationError("payment.goods_total", err.Error())
+		}
+	}
+
+	if !goodsTotal.Equal(payment.Money(payment.GoodsTotal)) {
+		return errors.NewValidationError("payment.goods_total",
+			fmt.Sprintf("must equal sum of items total_price (%s)", goodsTotal))
+	}
+
+	amount := goodsTotal
+	for _, part := range []model.Amount{payment.DeliveryCost, payment.CustomFee} {
+		var err error
+		if amount, err = amount.Add(payment.Money(part)); err != nil {
+			return errors.NewValidationError("payment.amount", err.Error())
+		}
+	}
+
+	if !amount.Equal(payment.Money(payment.Amount)) {
+		return errors.NewValidationError("payment.amount",
+			fmt.Sprintf("must equal goods_total + delivery_cost + custom_fee (%s)", amount))
+	}
+
+	return nil
+}
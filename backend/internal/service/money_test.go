@@ -0,0 +1,109 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// violatedField поле, на которое указывает ошибка валидации ("" - ошибки нет)
+func violatedField(t *testing.T, err error) string {
+	t.Helper()
+
+	if err == nil {
+		return ""
+	}
+	var appErr *errors.AppError
+	if !errors.IsAppError(err, &appErr) || appErr.Type != errors.ErrorTypeValidation {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	return appErr.Field
+}
+
+func TestValidateItemPrice(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		item  model.Item
+		field string
+	}{
+		{name: "no sale", item: model.Item{Price: 453, TotalPrice: 453}},
+		{name: "sale", item: model.Item{Price: 453, Sale: 30, TotalPrice: 317}},
+		{name: "sale rounded up", item: model.Item{Price: 453, Sale: 30, TotalPrice: 318}},
+		{name: "full sale", item: model.Item{Price: 453, Sale: 100, TotalPrice: 0}},
+		{name: "sale mismatch", item: model.Item{Price: 453, Sale: 30, TotalPrice: 300}, field: "items[0].total_price"},
+		{name: "total above price", item: model.Item{Price: 453, TotalPrice: 454}, field: "items[0].total_price"},
+		{name: "negative total", item: model.Item{Price: 453, TotalPrice: -1}, field: "items[0].total_price"},
+		{name: "sale above 100", item: model.Item{Price: 453, Sale: 101}, field: "items[0].sale"},
+		{name: "negative sale", item: model.Item{Price: 453, Sale: -1, TotalPrice: 453}, field: "items[0].sale"},
+		{name: "price overflow", item: model.Item{Price: math.MaxInt64, TotalPrice: math.MaxInt64}, field: "items[0].price"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if field := violatedField(t, validateItemPrice(&tc.item, 0)); field != tc.field {
+				t.Fatalf("expected violation of %q, got %q", tc.field, field)
+			}
+		})
+	}
+}
+
+func TestValidateTotals(t *testing.T) {
+	items := []model.Item{{TotalPrice: 317}, {TotalPrice: 1000}}
+	payment := func(amount, goodsTotal, deliveryCost, customFee model.Amount) *model.Payment {
+		return &model.Payment{
+			Transaction: "b563feb7b2b84b6test", Currency: "USD",
+			Amount: amount, GoodsTotal: goodsTotal, DeliveryCost: deliveryCost, CustomFee: customFee,
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		order model.Order
+		field string
+	}{
+		{name: "consistent", order: model.Order{Items: items, Payment: payment(2867, 1317, 1500, 50)}},
+		{name: "without payment", order: model.Order{Items: items}},
+		{name: "goods total mismatch", order: model.Order{Items: items, Payment: payment(2867, 1316, 1500, 51)}, field: "payment.goods_total"},
+		{name: "amount mismatch", order: model.Order{Items: items, Payment: payment(2817, 1317, 1500, 50)}, field: "payment.amount"},
+		{
+			name:  "goods total overflow",
+			order: model.Order{Items: []model.Item{{TotalPrice: math.MaxInt64}, {TotalPrice: 1}}, Payment: payment(0, 0, 0, 0)},
+			field: "payment.goods_total",
+		},
+		{
+			name:  "amount overflow",
+			order: model.Order{Items: []model.Item{{TotalPrice: math.MaxInt64}}, Payment: payment(0, math.MaxInt64, 1, 0)},
+			field: "payment.amount",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if field := violatedField(t, validateTotals(&tc.order)); field != tc.field {
+				t.Fatalf("expected violation of %q, got %q", tc.field, field)
+			}
+		})
+	}
+}
+
+func TestValidatePaymentCurrency(t *testing.T) {
+	s := &OrderService{}
+
+	for _, tc := range []struct {
+		currency string
+		field    string
+	}{
+		{currency: "USD"},
+		{currency: "SEK"},
+		{currency: "HKD"},
+		{currency: "JPY"},
+		{currency: "usd", field: "payment.currency"},
+		{currency: "XYZ", field: "payment.currency"},
+		{currency: "", field: "payment.currency"},
+	} {
+		t.Run(tc.currency, func(t *testing.T) {
+			payment := &model.Payment{Transaction: "b563feb7b2b84b6test", Currency: tc.currency, Provider: "wbpay", Amount: 1817}
+			if field := violatedField(t, s.validatePayment(payment)); field != tc.field {
+				t.Fatalf("expected violation of %q, got %q", tc.field, field)
+			}
+		})
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
+	"golang.org/x/sync/singleflight"
+
 	"github.com/makhkets/wildberries-l0/internal/cache"
 	"github.com/makhkets/wildberries-l0/internal/config"
 	"github.com/makhkets/wildberries-l0/internal/db"
@@ -17,16 +20,43 @@ import (
 
 type Order interface {
 	GetOrderByUID(ctx context.Context, uid string) (*model.Order, error)
+	GetOrderByTrackNumber(ctx context.Context, trackNumber string) (*model.Order, error)
+	GetOrderByTransaction(ctx context.Context, transaction string) (*model.Order, error)
+	GetOrderByRID(ctx context.Context, rid string) (*model.Order, error)
 	CreateOrder(ctx context.Context, order *model.Order) error
+	CreateOrders(ctx context.Context, orders []*model.Order) []error
+	ReplaceOrder(ctx context.Context, order *model.Order) error
+	PatchOrder(ctx context.Context, uid string, patch []byte, requestID string) (*model.Order, error)
+	DeleteOrder(ctx context.Context, uid, requestID string) error
+	ChangeStatus(ctx context.Context, uid string, change model.StatusChange) (*model.Order, error)
+	ListOrders(ctx context.Context, filter model.OrderFilter, cursor string) (*model.OrderPage, error)
+	SearchOrders(ctx context.Context, query string, limit, offset int) (*model.OrderSearchPage, error)
+	GetOrderHistory(ctx context.Context, uid string, limit int) ([]model.OrderHistoryEntry, error)
+	IsMessageProcessed(ctx context.Context, source *model.MessageSource) (bool, error)
+	ValidateOrder(order *model.Order) error
 
 	MustLoadCache(ctx context.Context)
 }
 
+// Ограничения выборки истории изменений заказа
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// maxUpdateAttempts максимальное количество попыток обновить заказ при конкурентных изменениях
+const maxUpdateAttempts = 3
+
 // OrderService представляет сервис для работы с заказами
 type OrderService struct {
 	repo   db.Repo
 	cache  cache.Repo
 	config *config.Config
+
+	// revalidating UID заказов, которые сейчас обновляются в кэше в фоне
+	revalidating sync.Map
+	// loads объединяет одновременные загрузки одного заказа из базы
+	loads singleflight.Group
 }
 
 // NewOrderService создает новый сервис заказов
@@ -39,27 +69,28 @@ func NewOrderService(repo db.Repo, cache cache.Repo, config *config.Config) Orde
 }
 
 func (s *OrderService) MustLoadCache(ctx context.Context) {
-	// Получаем все существующие ключи заказов в кэше
-	keys, err := s.cache.GetAllKeys(ctx, "order:*")
+	// Учитываем в индексе кэша заказы, сохраненные без него
+	if indexed, err := s.cache.RebuildIndex(ctx); err != nil {
+		slog.Error("Failed to rebuild cache index", sl.Err(err))
+	} else if indexed > 0 {
+		slog.Info("Cached orders added to cache index", "count", indexed)
+	}
+
+	// Количество заказов в кэше берется из индекса, без обхода ключей; истекшие заказы не учитываются
+	cached, err := s.cache.CountOrders(ctx)
 	if err != nil {
-		slog.Error("Failed to get all keys from cache", sl.Err(err))
+		slog.Error("Failed to count cached orders", sl.Err(err))
 		return
 	}
 
-	slog.Info("Current cache state", "cached_orders", len(keys), "max_orders", s.config.Redis.MaxOrders)
+	slog.Info("Current cache state", "cached_orders", cached, "max_orders", s.config.Redis.MaxOrders,
+		"eviction_policy", s.config.Redis.EvictionPolicy)
 
-	// Если кэш уже заполнен до максимума, очищаем его частично
-	if len(keys) >= s.config.Redis.MaxOrders {
-		err = s.cleanupOldestCacheEntries(ctx, len(keys)-s.config.Redis.MaxOrders+1)
-		if err != nil {
-			slog.Error("Failed to cleanup old cache entries", sl.Err(err))
-		}
-	}
-
-	// Определяем сколько заказов нужно загрузить
-	remainingSlots := s.config.Redis.MaxOrders - len(keys)
+	// Заполненный кэш не прогреваем: последние заказы вытеснили бы востребованные записи
+	remainingSlots := s.config.Redis.MaxOrders - int(cached)
 	if remainingSlots <= 0 {
-		remainingSlots = s.config.Redis.MaxOrders
+		slog.Info("Cache is already full, skipping warm-up")
+		return
 	}
 
 	// Загружаем заказы из базы данных
@@ -83,68 +114,9 @@ func (s *OrderService) MustLoadCache(ctx context.Context) {
 		"total_slots", s.config.Redis.MaxOrders)
 }
 
-// cleanupOldestCacheEntries удаляет самые старые записи из кэша
-func (s *OrderService) cleanupOldestCacheEntries(ctx context.Context, countToRemove int) error {
-	if countToRemove <= 0 {
-		return nil
-	}
-
-	keys, err := s.cache.GetAllKeys(ctx, "order:*")
-	if err != nil {
-		return fmt.Errorf("failed to get cache keys: %w", err)
-	}
-
-	if len(keys) == 0 {
-		return nil
-	}
-
-	// Ограничиваем количество удаляемых записей
-	if countToRemove > len(keys) {
-		countToRemove = len(keys)
-	}
-
-	// Удаляем первые N ключей (в Redis они возвращаются в произвольном порядке,
-	// но для управления размером кэша это приемлемо)
-	keysToDelete := keys[:countToRemove]
-
-	for _, key := range keysToDelete {
-		if err = s.cache.Delete(ctx, key); err != nil {
-			slog.Error("Failed to delete cache key", "key", key, "error", err)
-		}
-	}
-
-	slog.Info("Cleaned up old cache entries", "removed", len(keysToDelete))
-	return nil
-}
-
-// ensureCacheSpace проверяет и освобождает место в кэше для новых заказов
-func (s *OrderService) ensureCacheSpace(ctx context.Context, newOrdersCount int) error {
-	keys, err := s.cache.GetAllKeys(ctx, "order:*")
-	if err != nil {
-		return fmt.Errorf("failed to get cache keys: %w", err)
-	}
-
-	currentCount := len(keys)
-	maxOrders := s.config.Redis.MaxOrders
-
-	// Если добавление новых заказов превысит лимит, освобождаем место
-	if currentCount+newOrdersCount > maxOrders {
-		countToRemove := currentCount + newOrdersCount - maxOrders
-		return s.cleanupOldestCacheEntries(ctx, countToRemove)
-	}
-
-	return nil
-}
-
-// addOrderToCache добавляет заказ в кэш с проверкой размера
+// addOrderToCache добавляет заказ в кэш; при заполненном кэше
+// кэш сам вытесняет записи согласно политике вытеснения
 func (s *OrderService) addOrderToCache(ctx context.Context, order *model.Order) error {
-	// Проверяем, есть ли место в кэше
-	if err := s.ensureCacheSpace(ctx, 1); err != nil {
-		slog.Error("Failed to ensure cache space", "uid", order.OrderUID, "error", err)
-		return err
-	}
-
-	// Добавляем заказ в кэш
 	orders := []*model.Order{order}
 	successAdded := s.cache.SetOrders(ctx, orders)
 
@@ -164,15 +136,18 @@ func (s *OrderService) GetOrderByUID(ctx context.Context, uid string) (*model.Or
 		return nil, err
 	}
 
-	// Проверяем, есть ли в кэше ордер
-	order := s.cache.GetOrder(ctx, uid)
-	if order != nil {
-		slog.Info("Order retrieved from cache", slog.String("uid", uid))
-		return order, nil
+	// Проверяем, есть ли в кэше ордер; устаревшую запись отдаем сразу, обновляя ее в фоне
+	if entry := s.cache.GetOrderEntry(ctx, uid); entry != nil {
+		if entry.Stale {
+			s.revalidateOrder(uid)
+		}
+
+		slog.Info("Order retrieved from cache", slog.String("uid", uid), slog.Bool("stale", entry.Stale))
+		return entry.Order, nil
 	}
 
-	// Получаем заказ из repository
-	order, err := s.repo.GetOrderByUID(ctx, uid)
+	// Получаем заказ из repository; параллельные промахи по одному заказу ждут одной загрузки
+	order, err := s.loadOrder(ctx, uid)
 	if err != nil {
 		slog.Error("Failed to get order from repository",
 			"uid", uid, "error", err)
@@ -185,16 +160,84 @@ func (s *OrderService) GetOrderByUID(ctx context.Context, uid string) (*model.Or
 			"Failed to retrieve order")
 	}
 
-	// Добавляем заказ в кэш после получения из базы данных
-	if err := s.addOrderToCache(ctx, order); err != nil {
-		slog.Warn("Failed to cache order after retrieving from database", "uid", uid, "error", err)
-		// Не возвращаем ошибку, так как заказ успешно получен из БД
+	return order, nil
+}
+
+// loadTimeout ограничение времени загрузки заказа из базы при промахе кэша
+const loadTimeout = 10 * time.Second
+
+// loadOrder загружает заказ из базы и добавляет его в кэш. Одновременные загрузки одного заказа
+// объединяются: запрос к базе выполняет первый вызов, остальные получают его результат (тот же объект
+// заказа, поэтому изменять его нельзя). Загрузка не прерывается отменой контекста первого вызова,
+// а каждый вызов перестает ждать при отмене своего контекста
+func (s *OrderService) loadOrder(ctx context.Context, uid string) (*model.Order, error) {
+	result := s.loads.DoChan(uid, func() (interface{}, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+
+		order, err := s.repo.GetOrderByUID(loadCtx, uid)
+		if err != nil {
+			return nil, err
+		}
+
+		// Добавляем заказ в кэш после получения из базы данных
+		if err = s.addOrderToCache(loadCtx, order); err != nil {
+			slog.Warn("Failed to cache order after retrieving from database", "uid", uid, "error", err)
+			// Не возвращаем ошибку, так как заказ успешно получен из БД
+		}
+
+		return order, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		if res.Shared {
+			slog.Debug("Order load coalesced with concurrent request", "uid", uid)
+		}
+		return res.Val.(*model.Order), nil
+	}
+}
+
+// revalidationTimeout ограничение времени фонового обновления заказа в кэше
+const revalidationTimeout = 10 * time.Second
+
+// revalidateOrder в фоне перечитывает заказ из базы и обновляет его в кэше (stale-while-revalidate).
+// Для одного заказа одновременно выполняется не больше одного обновления
+func (s *OrderService) revalidateOrder(uid string) {
+	if _, running := s.revalidating.LoadOrStore(uid, struct{}{}); running {
+		return
 	}
 
-	return order, nil
+	go func() {
+		defer s.revalidating.Delete(uid)
+
+		// Обновление не зависит от контекста запроса, который уже получил устаревший заказ
+		ctx, cancel := context.WithTimeout(context.Background(), revalidationTimeout)
+		defer cancel()
+
+		// Загрузка объединяется с одновременными промахами и сама обновляет кэш
+		if _, err := s.loadOrder(ctx, uid); err != nil {
+			if errors.IsErrorType(err, errors.ErrorTypeNotFound) {
+				s.evictOrder(ctx, uid)
+				return
+			}
+
+			slog.Warn("Failed to revalidate cached order", "uid", uid, sl.Err(err))
+			return
+		}
+
+		slog.Debug("Cached order revalidated", "uid", uid)
+	}()
 }
 
-// CreateOrder создает новый заказ с валидацией или обновляет существующий
+// CreateOrder создает новый заказ с валидацией или обновляет существующий.
+// Полная валидация выполняется только при создании: обновление может содержать
+// лишь часть полей, которые объединяются с существующим заказом
 func (s *OrderService) CreateOrder(ctx context.Context, order *model.Order) error {
 	// Проверяем, существует ли заказ
 	existingOrder, err := s.GetOrderByUID(ctx, order.OrderUID)
@@ -206,6 +249,10 @@ func (s *OrderService) CreateOrder(ctx context.Context, order *model.Order) erro
 		}
 
 		// Заказ не найден - создаем новый
+		if err = s.validateOrder(order); err != nil {
+			return err
+		}
+
 		slog.Info("Creating new order", "uid", order.OrderUID)
 
 		err = s.repo.CreateOrder(ctx, order)
@@ -234,34 +281,148 @@ func (s *OrderService) CreateOrder(ctx context.Context, order *model.Order) erro
 	// Заказ уже существует - обновляем его
 	slog.Info("Order already exists, updating with new data", "uid", order.OrderUID)
 
-	// Объединяем существующие данные с новыми
-	updatedOrder := s.mergeOrderData(existingOrder, order)
+	return s.updateExistingOrder(ctx, existingOrder, order)
+}
+
+// updateExistingOrder объединяет существующий заказ с новыми данными и сохраняет результат.
+// Если заказ был изменен параллельно (версия не совпала), заказ перечитывается из базы
+// и объединение повторяется, но не более maxUpdateAttempts раз
+func (s *OrderService) updateExistingOrder(ctx context.Context, existingOrder, order *model.Order) error {
+	// Полный снимок заменяет товары и суммы платежа, поэтому суммы проверяются в нем самом
+	snapshot := isOrderSnapshot(order)
+	if snapshot {
+		if err := validateTotals(order); err != nil {
+			slog.Warn("Order update has inconsistent totals", "uid", order.OrderUID, "error", err)
+			return err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		// Объединяем существующие данные с новыми
+		updatedOrder := s.mergeOrderData(existingOrder, order)
+
+		// Объединение частичных данных не должно нарушать согласованность сумм
+		if !snapshot {
+			if err := validateTotals(updatedOrder); err != nil {
+				slog.Warn("Merged order has inconsistent totals", "uid", order.OrderUID, "error", err)
+				return err
+			}
+		}
+
+		// Обновляем заказ в базе данных
+		err := s.repo.UpdateOrder(ctx, updatedOrder)
+		if err == nil {
+			// Копируем сохраненные (перечитанные из БД) данные обратно в переданный объект
+			*order = *updatedOrder
+
+			// Обновляем заказ в кэше после успешного обновления
+			if err = s.addOrderToCache(ctx, updatedOrder); err != nil {
+				slog.Warn("Failed to cache order after update", "uid", order.OrderUID, "error", err)
+				// Не возвращаем ошибку, так как заказ успешно обновлен в БД
+			}
+
+			slog.Info("Order updated successfully", "uid", order.OrderUID, "version", order.Version)
+			return nil
+		}
+
+		if errors.IsVersionConflict(err) && attempt < maxUpdateAttempts {
+			slog.Warn("Order was modified concurrently, retrying merge",
+				"uid", order.OrderUID, "attempt", attempt)
+
+			// Кэш может содержать устаревшую версию, поэтому читаем заказ из базы
+			existingOrder, err = s.repo.GetOrderByUID(ctx, order.OrderUID)
+			if err == nil {
+				continue
+			}
+		}
 
-	// Обновляем заказ в базе данных
-	err = s.repo.UpdateOrder(ctx, updatedOrder)
-	if err != nil {
 		slog.Error("Failed to update order in repository",
 			"uid", order.OrderUID, "error", err)
 
-		if errors.IsErrorType(err, errors.ErrorTypeNotFound) {
+		if errors.IsErrorType(err, errors.ErrorTypeNotFound) || errors.IsErrorType(err, errors.ErrorTypeConflict) {
 			return err
 		}
 
 		return errors.NewAppError(errors.ErrorTypeInternal,
 			"Failed to update order")
 	}
+}
+
+// CreateOrders пакетно создает новые заказы. Заказы, которые уже существуют в БД,
+// обновляются по одному через CreateOrder (с объединением данных), а заказы из уже обработанных
+// сообщений пропускаются с DuplicateMessageError.
+// Возвращает срез ошибок той же длины, что и orders: ошибка одного заказа не влияет на остальные
+func (s *OrderService) CreateOrders(ctx context.Context, orders []*model.Order) []error {
+	results := s.repo.CreateOrders(ctx, orders)
+
+	created := 0
+	for i, order := range orders {
+		err := results[i]
+		if err == nil {
+			created++
+			if err = s.addOrderToCache(ctx, order); err != nil {
+				slog.Warn("Failed to cache order after batch creation", "uid", order.OrderUID, "error", err)
+			}
+			continue
+		}
+
+		// Сообщение заказа уже обработано - заказ не сохраняется повторно
+		if errors.IsDuplicateMessage(err) {
+			continue
+		}
+
+		// Заказ уже существует (или повторяется в пакете) - обновляем его обычным путем
+		if errors.IsErrorType(err, errors.ErrorTypeConflict) {
+			results[i] = s.CreateOrder(ctx, order)
+			continue
+		}
+
+		slog.Error("Failed to create order in batch", "uid", order.OrderUID, "error", err)
+		results[i] = errors.NewAppError(errors.ErrorTypeInternal, "Failed to create order")
+	}
 
-	// Копируем обновленные данные обратно в переданный объект
-	*order = *updatedOrder
+	slog.Info("Orders batch processed", "total", len(orders), "created", created)
+	return results
+}
 
-	// Обновляем заказ в кэше после успешного обновления
-	if err := s.addOrderToCache(ctx, updatedOrder); err != nil {
-		slog.Warn("Failed to cache order after update", "uid", order.OrderUID, "error", err)
-		// Не возвращаем ошибку, так как заказ успешно обновлен в БД
+// GetOrderHistory возвращает историю изменений заказа, начиная с последнего.
+// limit <= 0 означает значение по умолчанию
+func (s *OrderService) GetOrderHistory(ctx context.Context, uid string, limit int) ([]model.OrderHistoryEntry, error) {
+	if err := s.validateOrderUID(uid); err != nil {
+		return nil, err
 	}
 
-	slog.Info("Order updated successfully", "uid", order.OrderUID)
-	return nil
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		return nil, errors.NewValidationError("limit", fmt.Sprintf("must not exceed %d", maxHistoryLimit))
+	}
+
+	entries, err := s.repo.GetOrderHistory(ctx, uid, limit)
+	if err != nil {
+		slog.Error("Failed to get order history from repository", "uid", uid, "error", err)
+		return nil, errors.NewAppError(errors.ErrorTypeInternal, "Failed to retrieve order history")
+	}
+
+	// Пустая история у существующего заказа возможна для заказов, созданных до ее появления
+	if len(entries) == 0 {
+		exists, err := s.repo.OrderExists(ctx, uid)
+		if err != nil {
+			slog.Error("Failed to check order existence", "uid", uid, "error", err)
+			return nil, errors.NewAppError(errors.ErrorTypeInternal, "Failed to retrieve order history")
+		}
+		if !exists {
+			return nil, errors.NewNotFoundError("order")
+		}
+	}
+
+	return entries, nil
+}
+
+// IsMessageProcessed проверяет по журналу, было ли сообщение Kafka уже обработано
+func (s *OrderService) IsMessageProcessed(ctx context.Context, source *model.MessageSource) (bool, error) {
+	return s.repo.IsMessageProcessed(ctx, source)
 }
 
 // validateOrderUID проверяет корректность UID заказа
@@ -283,6 +444,11 @@ func (s *OrderService) validateOrderUID(uid string) error {
 	return nil
 }
 
+// ValidateOrder проверяет корректность данных заказа перед сохранением
+func (s *OrderService) ValidateOrder(order *model.Order) error {
+	return s.validateOrder(order)
+}
+
 // validateOrder проверяет корректность данных заказа
 func (s *OrderService) validateOrder(order *model.Order) error {
 	if order == nil {
@@ -327,7 +493,8 @@ func (s *OrderService) validateOrder(order *model.Order) error {
 		}
 	}
 
-	return nil
+	// Суммы платежа должны сходиться с товарами
+	return validateTotals(order)
 }
 
 // validateDelivery проверяет данные доставки
@@ -370,6 +537,10 @@ func (s *OrderService) validatePayment(payment *model.Payment) error {
 		return errors.NewValidationError("payment.currency", "cannot be empty")
 	}
 
+	if _, ok := model.Currency(payment.Currency).MinorUnits(); !ok {
+		return errors.NewValidationError("payment.currency", "unknown ISO 4217 currency code")
+	}
+
 	if payment.Provider == "" {
 		return errors.NewValidationError("payment.provider", "cannot be empty")
 	}
@@ -378,6 +549,10 @@ func (s *OrderService) validatePayment(payment *model.Payment) error {
 		return errors.NewValidationError("payment.amount", "must be greater than 0")
 	}
 
+	if payment.DeliveryCost < 0 || payment.GoodsTotal < 0 || payment.CustomFee < 0 {
+		return errors.NewValidationError("payment", "delivery_cost, goods_total and custom_fee cannot be negative")
+	}
+
 	return nil
 }
 
@@ -395,6 +570,10 @@ func (s *OrderService) validateItem(item *model.Item, index int) error {
 		return errors.NewValidationError(fmt.Sprintf("items[%d].price", index), "must be greater than 0")
 	}
 
+	if err := validateItemPrice(item, index); err != nil {
+		return err
+	}
+
 	if item.Brand == "" {
 		return errors.NewValidationError(fmt.Sprintf("items[%d].brand", index), "cannot be empty")
 	}
@@ -461,15 +640,35 @@ func (s *OrderService) mergeOrderData(existing, new *model.Order) *model.Order {
 	mergedPayment := s.mergePaymentData(updated.Payment, new.Payment)
 	updated.Payment = &mergedPayment
 
-	// Обновляем товарные позиции
-	updated.Items = s.mergeItemsData(updated.Items, new.Items)
+	// Полный снимок заменяет товары и суммы платежа целиком: объединение оставило бы
+	// удаленные из заказа товары и нулевые суммы из старых данных
+	if isOrderSnapshot(new) {
+		updated.Items = new.Items
+		updated.Payment.Amount = new.Payment.Amount
+		updated.Payment.DeliveryCost = new.Payment.DeliveryCost
+		updated.Payment.GoodsTotal = new.Payment.GoodsTotal
+		updated.Payment.CustomFee = new.Payment.CustomFee
+	} else {
+		// Обновляем товарные позиции
+		updated.Items = s.mergeItemsData(updated.Items, new.Items)
+	}
 
 	// Обновляем время изменения
 	updated.UpdatedAt = time.Now()
 
+	// Изменение сохраняется вместе с записью об исходном сообщении
+	updated.Source = new.Source
+	updated.RequestID = new.RequestID
+
 	return &updated
 }
 
+// isOrderSnapshot проверяет, что обновление содержит полный снимок товаров и платежа
+// (как сообщения Kafka), а не отдельные поля для объединения с существующим заказом
+func isOrderSnapshot(order *model.Order) bool {
+	return len(order.Items) > 0 && order.Payment != nil && order.Payment.Transaction != ""
+}
+
 // mergeDeliveryData объединяет данные доставки
 func (s *OrderService) mergeDeliveryData(existing, new *model.Delivery) model.Delivery {
 	// Если existing равен nil, возвращаем new или пустую структуру
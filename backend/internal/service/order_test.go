@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/makhkets/wildberries-l0/internal/cache"
+	"github.com/makhkets/wildberries-l0/internal/config"
+	"github.com/makhkets/wildberries-l0/internal/db"
+	"github.com/makhkets/wildberries-l0/internal/model"
+	"github.com/makhkets/wildberries-l0/pkg/lib/logger/handlers/slogdiscard"
+)
+
+func TestMain(m *testing.M) {
+	// Логи сервиса на каждый запрос заслонили бы вывод тестов
+	slog.SetDefault(slogdiscard.NewDiscardLogger())
+	os.Exit(m.Run())
+}
+
+// countingRepo заглушка базы: считает загрузки заказов и отвечает с задержкой
+// или, если задан release, после его закрытия. Остальные методы db.Repo тестами не используются
+type countingRepo struct {
+	db.Repo
+
+	latency time.Duration
+	release chan struct{}
+	queries atomic.Int64
+}
+
+func (r *countingRepo) GetOrderByUID(ctx context.Context, uid string) (*model.Order, error) {
+	r.queries.Add(1)
+
+	// Из nil-канала чтение блокируется, поэтому срабатывает только заданный вариант ответа
+	var latency <-chan time.Time
+	if r.release == nil {
+		latency = time.After(r.latency)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-latency:
+	case <-r.release:
+	}
+
+	return &model.Order{OrderUID: uid}, nil
+}
+
+// missingCache заглушка кэша, в котором никогда нет заказов (каждый запрос - промах).
+// Считает обращения, чтобы тест знал, что запрос дошел до загрузки из базы
+type missingCache struct {
+	cache.Repo
+
+	lookups atomic.Int64
+}
+
+func (c *missingCache) GetOrderEntry(context.Context, string) *cache.CachedOrder {
+	c.lookups.Add(1)
+	return nil
+}
+
+func (c *missingCache) SetOrders(_ context.Context, orders []*model.Order) int {
+	return len(orders)
+}
+
+// newCoalescingService сервис заказов поверх заглушек базы и пустого кэша
+func newCoalescingService(repo *countingRepo) (*OrderService, *missingCache) {
+	orderCache := &missingCache{}
+	return NewOrderService(repo, orderCache, &config.Config{}).(*OrderService), orderCache
+}
+
+// requestOrders одновременно запрашивает заказы: requests запросов, распределенных по orders заказам.
+// Возвращает количество неудачных запросов
+func requestOrders(s *OrderService, requests, orders int) int64 {
+	var failed atomic.Int64
+	var wg sync.WaitGroup
+
+	start := make(chan struct{})
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+
+			if _, err := s.GetOrderByUID(context.Background(), fmt.Sprintf("coalesced-order-%d", i%orders)); err != nil {
+				failed.Add(1)
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	return failed.Load()
+}
+
+func TestGetOrderByUIDCoalescesMisses(t *testing.T) {
+	const (
+		concurrency = 100
+		rounds      = 5
+		orders      = 3
+	)
+
+	repo := &countingRepo{latency: 50 * time.Millisecond}
+	s, _ := newCoalescingService(repo)
+
+	for round := 0; round < rounds; round++ {
+		before := repo.queries.Load()
+
+		if failed := requestOrders(s, concurrency, orders); failed > 0 {
+			t.Fatalf("round %d: %d requests failed", round, failed)
+		}
+		// Без объединения запросов к базе было бы столько же, сколько запросов к сервису
+		if queries := repo.queries.Load() - before; queries != orders {
+			t.Fatalf("round %d: expected %d database queries, got %d", round, orders, queries)
+		}
+	}
+}
+
+func TestGetOrderByUIDCancelledWaiterDoesNotCancelLoad(t *testing.T) {
+	const uid = "coalesced-order-cancel"
+
+	repo := &countingRepo{release: make(chan struct{})}
+	s, orderCache := newCoalescingService(repo)
+
+	// Первый запрос начинает загрузку и затем отменяется
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := s.GetOrderByUID(ctx, uid)
+		cancelled <- err
+	}()
+	waitFor(t, func() bool { return repo.queries.Load() == 1 })
+
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			order, err := s.GetOrderByUID(context.Background(), uid)
+			if err == nil && order.OrderUID != uid {
+				err = fmt.Errorf("unexpected order %s", order.OrderUID)
+			}
+			results <- err
+		}()
+	}
+	// Промах кэша отмечен, запросу осталось только присоединиться к загрузке
+	waitFor(t, func() bool { return orderCache.lookups.Load() == 3 })
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-cancelled:
+		if err == nil {
+			t.Fatal("cancelled request must fail")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancelled request must stop waiting for the load")
+	}
+
+	// Загрузка продолжается и завершается для оставшихся запросов
+	close(repo.release)
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Fatalf("waiting request failed: %v", err)
+		}
+	}
+	if queries := repo.queries.Load(); queries != 1 {
+		t.Fatalf("expected a single database query, got %d", queries)
+	}
+}
+
+// BenchmarkGetOrderByUIDMisses параллельные промахи кэша по нескольким популярным заказам;
+// queries/op показывает долю запросов, дошедших до базы
+func BenchmarkGetOrderByUIDMisses(b *testing.B) {
+	const orders = 3
+
+	repo := &countingRepo{latency: time.Millisecond}
+	s, _ := newCoalescingService(repo)
+
+	// Запросы ждут ответа базы, поэтому одновременных запросов нужно больше, чем процессоров
+	b.SetParallelism(100)
+
+	var next atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			uid := fmt.Sprintf("coalesced-order-%d", next.Add(1)%orders)
+			if _, err := s.GetOrderByUID(context.Background(), uid); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+
+	b.ReportMetric(float64(repo.queries.Load())/float64(b.N), "queries/op")
+}
+
+// waitFor ждет выполнения условия не дольше секунды
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// updatingRepo заглушка базы с одним существующим заказом: запоминает последнее обновление
+type updatingRepo struct {
+	db.Repo
+
+	order   *model.Order
+	updated *model.Order
+}
+
+func (r *updatingRepo) GetOrderByUID(_ context.Context, uid string) (*model.Order, error) {
+	order := *r.order
+	order.Payment = new(model.Payment)
+	*order.Payment = *r.order.Payment
+	order.Items = append([]model.Item(nil), r.order.Items...)
+	return &order, nil
+}
+
+func (r *updatingRepo) UpdateOrder(_ context.Context, order *model.Order) error {
+	r.updated = order
+	return nil
+}
+
+// existingOrder заказ из двух товаров с согласованными суммами
+func existingOrder() *model.Order {
+	return &model.Order{
+		OrderUID: "existing-order-uid", TrackNumber: "WBILMTESTTRACK", CustomerID: "test",
+		Delivery: &model.Delivery{Name: "Test Testov", Phone: "+9720000000", Address: "Ploshad Mira 15"},
+		Payment: &model.Payment{
+			Transaction: "existing-order-uid", Currency: "USD", Provider: "wbpay",
+			Amount: 370, DeliveryCost: 50, GoodsTotal: 300, CustomFee: 20,
+		},
+		Items: []model.Item{
+			{ChrtID: 1, Name: "Mascaras", Brand: "Vivienne Sabo", Price: 100, TotalPrice: 100},
+			{ChrtID: 2, Name: "Lipstick", Brand: "Vivienne Sabo", Price: 200, TotalPrice: 200},
+		},
+	}
+}
+
+func TestCreateOrderUpdatesExistingOrder(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		update *model.Order
+		items  int
+		amount model.Amount
+	}{
+		{
+			// Частичное обновление объединяется с заказом без полной валидации
+			name:   "partial payload",
+			update: &model.Order{OrderUID: "existing-order-uid", TrackNumber: "WBILMNEWTRACK"},
+			items:  2,
+			amount: 370,
+		},
+		{
+			// Полный снимок без одного из товаров заменяет товары и суммы, а не объединяется с ними
+			name: "snapshot without an item",
+			update: &model.Order{
+				OrderUID: "existing-order-uid", TrackNumber: "WBILMTESTTRACK", CustomerID: "test",
+				Payment: &model.Payment{
+					Transaction: "existing-order-uid", Currency: "USD", Provider: "wbpay",
+					Amount: 150, DeliveryCost: 50, GoodsTotal: 100,
+				},
+				Items: []model.Item{{ChrtID: 1, Name: "Mascaras", Brand: "Vivienne Sabo", Price: 100, TotalPrice: 100}},
+			},
+			items:  1,
+			amount: 150,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &updatingRepo{order: existingOrder()}
+			s := NewOrderService(repo, &missingCache{}, &config.Config{})
+
+			if err := s.CreateOrder(context.Background(), tc.update); err != nil {
+				t.Fatalf("update rejected: %v", err)
+			}
+			if repo.updated == nil {
+				t.Fatal("order was not updated")
+			}
+			if len(repo.updated.Items) != tc.items || repo.updated.Payment.Amount != tc.amount {
+				t.Fatalf("expected %d items and amount %d, got %d items and amount %d",
+					tc.items, tc.amount, len(repo.updated.Items), repo.updated.Payment.Amount)
+			}
+		})
+	}
+}
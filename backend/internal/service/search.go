@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// Ограничения поискового запроса
+const (
+	maxSearchQueryLength = 200
+	maxSearchOffset      = 10_000
+)
+
+// SearchOrders ищет заказы по имени покупателя, городу, адресу, email, названиям и брендам товаров.
+// Результаты отсортированы по релевантности; limit <= 0 означает значение по умолчанию
+func (s *OrderService) SearchOrders(ctx context.Context, query string, limit, offset int) (*model.OrderSearchPage, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, errors.NewValidationError("q", "cannot be empty")
+	}
+	if utf8.RuneCountInString(query) > maxSearchQueryLength {
+		return nil, errors.NewValidationError("q", fmt.Sprintf("must not exceed %d characters", maxSearchQueryLength))
+	}
+
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		return nil, errors.NewValidationError("limit", fmt.Sprintf("must not exceed %d", maxPageLimit))
+	}
+	if offset < 0 || offset > maxSearchOffset {
+		return nil, errors.NewValidationError("offset", fmt.Sprintf("must be between 0 and %d", maxSearchOffset))
+	}
+
+	// Запрашиваем на один результат больше, чтобы понять, есть ли следующая страница
+	results, err := s.repo.SearchOrders(ctx, query, limit+1, offset)
+	if err != nil {
+		slog.Error("Failed to search orders in repository", "query", query, "error", err)
+		return nil, errors.NewAppError(errors.ErrorTypeInternal, "Failed to search orders")
+	}
+
+	page := &model.OrderSearchPage{
+		Results: results,
+		Limit:   limit,
+		Offset:  offset,
+	}
+	if len(results) > limit {
+		page.Results = results[:limit]
+		page.HasMore = true
+	}
+
+	return page, nil
+}
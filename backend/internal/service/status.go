@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+)
+
+// orderTransitions допустимые переходы статуса заказа:
+// New → Processing → Shipped → Delivered, из любого статуса - в Cancelled
+var orderTransitions = map[model.OrderStatus][]model.OrderStatus{
+	model.OrderStatusNew:        {model.OrderStatusProcessing, model.OrderStatusCancelled},
+	model.OrderStatusProcessing: {model.OrderStatusShipped, model.OrderStatusCancelled},
+	model.OrderStatusShipped:    {model.OrderStatusDelivered, model.OrderStatusCancelled},
+	model.OrderStatusDelivered:  {model.OrderStatusCancelled},
+}
+
+// paymentTransitions допустимые переходы статуса платежа:
+// Pending → Completed или Failed, Completed или Failed → Refunded
+var paymentTransitions = map[model.PaymentStatus][]model.PaymentStatus{
+	model.PaymentStatusPending:   {model.PaymentStatusCompleted, model.PaymentStatusFailed},
+	model.PaymentStatusCompleted: {model.PaymentStatusRefunded},
+	model.PaymentStatusFailed:    {model.PaymentStatusRefunded},
+}
+
+// canTransition проверяет, разрешен ли переход from → to
+func canTransition[S comparable](transitions map[S][]S, from, to S) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangeStatus переводит заказ и/или его платеж в новый статус. Недопустимый переход
+// отклоняется ошибкой валидации; при параллельном изменении заказа проверка повторяется
+// на актуальных данных, но не более maxUpdateAttempts раз
+func (s *OrderService) ChangeStatus(ctx context.Context, uid string, change model.StatusChange) (*model.Order, error) {
+	if err := s.validateOrderUID(uid); err != nil {
+		return nil, err
+	}
+	if change.OrderStatus == nil && change.PaymentStatus == nil {
+		return nil, errors.NewValidationError("status", "order or payment status is required")
+	}
+
+	for attempt := 1; ; attempt++ {
+		current, err := s.repo.GetOrderByUID(ctx, uid)
+		if err != nil {
+			if errors.IsErrorType(err, errors.ErrorTypeNotFound) {
+				return nil, err
+			}
+
+			slog.Error("Failed to get order from repository", "uid", uid, "error", err)
+			return nil, errors.NewAppError(errors.ErrorTypeInternal, "Failed to change order status")
+		}
+
+		if err = validateStatusChange(current, change); err != nil {
+			return nil, err
+		}
+
+		order, err := s.repo.ChangeStatus(ctx, current, change)
+		if err == nil {
+			if err = s.addOrderToCache(ctx, order); err != nil {
+				slog.Warn("Failed to cache order after status change", "uid", uid, "error", err)
+			}
+
+			slog.Info("Order status changed",
+				"uid", uid, "status", order.Status.String(), "payment_status", order.Payment.Status.String())
+			return order, nil
+		}
+
+		if errors.IsVersionConflict(err) && attempt < maxUpdateAttempts {
+			slog.Warn("Order was modified concurrently, retrying status change", "uid", uid, "attempt", attempt)
+			continue
+		}
+
+		slog.Error("Failed to change order status in repository", "uid", uid, "error", err)
+
+		if errors.IsErrorType(err, errors.ErrorTypeNotFound) || errors.IsErrorType(err, errors.ErrorTypeConflict) {
+			return nil, err
+		}
+
+		return nil, errors.NewAppError(errors.ErrorTypeInternal, "Failed to change order status")
+	}
+}
+
+// validateStatusChange проверяет запрошенные переходы по конечным автоматам статусов
+func validateStatusChange(current *model.Order, change model.StatusChange) error {
+	if change.OrderStatus != nil && !canTransition(orderTransitions, current.Status, *change.OrderStatus) {
+		return errors.NewValidationError("status", fmt.Sprintf("transition from %s to %s is not allowed",
+			current.Status, *change.OrderStatus))
+	}
+
+	if change.PaymentStatus != nil {
+		if current.Payment == nil || current.Payment.Transaction == "" {
+			return errors.NewValidationError("payment_status", "order has no payment")
+		}
+
+		if !canTransition(paymentTransitions, current.Payment.Status, *change.PaymentStatus) {
+			return errors.NewValidationError("payment_status", fmt.Sprintf("transition from %s to %s is not allowed",
+				current.Payment.Status, *change.PaymentStatus))
+		}
+	}
+
+	return nil
+}
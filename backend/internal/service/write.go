@@ -0,0 +1,140 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/makhkets/wildberries-l0/internal/errors"
+	"github.com/makhkets/wildberries-l0/internal/model"
+	"github.com/makhkets/wildberries-l0/pkg/lib/logger/sl"
+	"github.com/makhkets/wildberries-l0/pkg/utils"
+)
+
+// DeleteOrder мягко удаляет заказ (до архивации он хранится в базе) и вытесняет его из кэша
+func (s *OrderService) DeleteOrder(ctx context.Context, uid, requestID string) error {
+	if err := s.validateOrderUID(uid); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteOrder(ctx, uid, requestID); err != nil {
+		if errors.IsErrorType(err, errors.ErrorTypeNotFound) {
+			return err
+		}
+
+		slog.Error("Failed to delete order in repository", "uid", uid, "error", err)
+		return errors.NewAppError(errors.ErrorTypeInternal, "Failed to delete order")
+	}
+
+	s.evictOrder(ctx, uid)
+
+	slog.Info("Order deleted successfully", "uid", uid)
+	return nil
+}
+
+// ReplaceOrder заменяет заказ целиком: поля, отсутствующие в order, очищаются.
+// Если order.Version задана, заказ заменяется только при совпадении версии.
+// Статусы заказа и платежа не заменяются - они изменяются только через ChangeStatus
+func (s *OrderService) ReplaceOrder(ctx context.Context, order *model.Order) error {
+	if err := s.validateOrder(order); err != nil {
+		return err
+	}
+
+	existing, err := s.repo.GetOrderByUID(ctx, order.OrderUID)
+	if err != nil {
+		if errors.IsErrorType(err, errors.ErrorTypeNotFound) {
+			return err
+		}
+
+		slog.Error("Failed to get order from repository", "uid", order.OrderUID, "error", err)
+		return errors.NewAppError(errors.ErrorTypeInternal, "Failed to replace order")
+	}
+
+	if order.Version == 0 {
+		order.Version = existing.Version
+	}
+
+	return s.saveOrder(ctx, order, "Failed to replace order")
+}
+
+// PatchOrder применяет к заказу JSON Merge Patch (RFC 7396): null удаляет значение
+// (например, доставку или платеж), массив items заменяется целиком.
+// Если патч содержит version, заказ изменяется только при совпадении версии
+func (s *OrderService) PatchOrder(ctx context.Context, uid string, patch []byte, requestID string) (*model.Order, error) {
+	if err := s.validateOrderUID(uid); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.GetOrderByUID(ctx, uid)
+	if err != nil {
+		if errors.IsErrorType(err, errors.ErrorTypeNotFound) {
+			return nil, err
+		}
+
+		slog.Error("Failed to get order from repository", "uid", uid, "error", err)
+		return nil, errors.NewAppError(errors.ErrorTypeInternal, "Failed to patch order")
+	}
+
+	current, err := json.Marshal(existing)
+	if err != nil {
+		return nil, errors.WrapError(errors.ErrorTypeInternal, "Failed to patch order", err)
+	}
+
+	patched, err := utils.MergePatch(current, patch)
+	if err != nil {
+		return nil, errors.NewValidationError("request_body", err.Error())
+	}
+
+	var order model.Order
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&order); err != nil {
+		return nil, errors.NewValidationError("request_body", "patched order is invalid: "+err.Error())
+	}
+
+	if order.OrderUID != uid {
+		return nil, errors.NewValidationError("order_uid", "cannot be changed")
+	}
+
+	// Служебные поля не изменяются патчем
+	order.ID, order.CreatedAt, order.UpdatedAt = existing.ID, existing.CreatedAt, existing.UpdatedAt
+	order.RequestID = requestID
+
+	if err = s.validateOrder(&order); err != nil {
+		return nil, err
+	}
+
+	if err = s.saveOrder(ctx, &order, "Failed to patch order"); err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+// saveOrder сохраняет заказ без объединения с текущими данными и обновляет кэш
+func (s *OrderService) saveOrder(ctx context.Context, order *model.Order, failure string) error {
+	if err := s.repo.UpdateOrder(ctx, order); err != nil {
+		slog.Error("Failed to update order in repository", "uid", order.OrderUID, "error", err)
+
+		if errors.IsErrorType(err, errors.ErrorTypeNotFound) || errors.IsErrorType(err, errors.ErrorTypeConflict) {
+			return err
+		}
+
+		return errors.NewAppError(errors.ErrorTypeInternal, failure)
+	}
+
+	if err := s.addOrderToCache(ctx, order); err != nil {
+		slog.Warn("Failed to cache order after update", "uid", order.OrderUID, "error", err)
+	}
+
+	slog.Info("Order saved successfully", "uid", order.OrderUID, "version", order.Version)
+	return nil
+}
+
+// evictOrder удаляет заказ из кэша
+func (s *OrderService) evictOrder(ctx context.Context, uid string) {
+	if err := s.cache.DeleteOrder(ctx, uid); err != nil {
+		slog.Warn("Failed to evict order from cache", "uid", uid, sl.Err(err))
+	}
+}
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_processed_messages_processed_at;
+DROP INDEX IF EXISTS idx_processed_messages_order_uid;
+
+DROP TABLE IF EXISTS processed_messages;
@@ -0,0 +1,14 @@
+-- Журнал обработанных сообщений Kafka для идемпотентной обработки
+CREATE TABLE IF NOT EXISTS processed_messages (
+    topic VARCHAR(255) NOT NULL,
+    partition INTEGER NOT NULL,
+    "offset" BIGINT NOT NULL,
+    message_key VARCHAR(255),
+    content_hash CHAR(64) NOT NULL,
+    order_uid VARCHAR(255) NOT NULL,
+    processed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (topic, partition, "offset")
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_messages_order_uid ON processed_messages(order_uid);
+CREATE INDEX IF NOT EXISTS idx_processed_messages_processed_at ON processed_messages(processed_at);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_outbox_aggregate_id;
+DROP INDEX IF EXISTS idx_outbox_unsent;
+
+DROP TABLE IF EXISTS outbox;
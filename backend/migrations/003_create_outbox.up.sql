@@ -0,0 +1,13 @@
+-- Outbox событий об изменении заказов, записывается в одной транзакции с заказом
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    aggregate_id VARCHAR(255) NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP
+);
+
+-- Индекс для выборки неотправленных событий в порядке записи
+CREATE INDEX IF NOT EXISTS idx_outbox_unsent ON outbox(id) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_aggregate_id ON outbox(aggregate_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_delivery_order_id;
+DROP INDEX IF EXISTS idx_payment_order_id;
+
+CREATE INDEX IF NOT EXISTS idx_delivery_order_id ON delivery(order_id);
+CREATE INDEX IF NOT EXISTS idx_payment_order_id ON payment(order_id);
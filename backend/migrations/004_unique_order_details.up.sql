@@ -0,0 +1,13 @@
+-- У заказа одна запись доставки и одна запись платежа: удаляем дубликаты,
+-- оставляя последнюю запись, и закрепляем это уникальными индексами для upsert
+DELETE FROM delivery d USING delivery newer
+WHERE d.order_id = newer.order_id AND d.id < newer.id;
+
+DELETE FROM payment p USING payment newer
+WHERE p.order_id = newer.order_id AND p.id < newer.id;
+
+DROP INDEX IF EXISTS idx_delivery_order_id;
+DROP INDEX IF EXISTS idx_payment_order_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_delivery_order_id ON delivery(order_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_order_id ON payment(order_id);
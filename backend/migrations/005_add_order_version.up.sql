@@ -0,0 +1,2 @@
+-- Версия заказа для оптимистической блокировки: увеличивается при каждом обновлении
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
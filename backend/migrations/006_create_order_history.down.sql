@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_order_history_order_uid;
+
+DROP TABLE IF EXISTS order_history;
@@ -0,0 +1,16 @@
+-- История изменений заказов: снимок заказа после каждого создания и обновления
+CREATE TABLE IF NOT EXISTS order_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    source VARCHAR(16) NOT NULL,
+    kafka_topic VARCHAR(255),
+    kafka_partition INTEGER,
+    kafka_offset BIGINT,
+    request_id VARCHAR(255),
+    snapshot JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_history_order_uid ON order_history(order_uid, id);
@@ -0,0 +1,2 @@
+-- Индекс для постраничного просмотра заказов по курсору (created_at, id)
+CREATE INDEX IF NOT EXISTS idx_orders_created_at_id ON orders(created_at DESC, id DESC);
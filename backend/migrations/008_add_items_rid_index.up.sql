@@ -0,0 +1,2 @@
+-- Индекс для поиска заказа по rid товарной позиции
+CREATE INDEX IF NOT EXISTS idx_items_rid ON items(rid);
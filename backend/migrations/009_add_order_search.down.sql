@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_items_search_trgm;
+DROP INDEX IF EXISTS idx_delivery_search_trgm;
+DROP INDEX IF EXISTS idx_items_search_vector;
+DROP INDEX IF EXISTS idx_delivery_search_vector;
+
+ALTER TABLE items DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE delivery DROP COLUMN IF EXISTS search_vector;
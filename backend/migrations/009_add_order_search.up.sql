@@ -0,0 +1,26 @@
+-- Полнотекстовый и нечеткий (триграммный) поиск по данным покупателя и товарам
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Конфигурация simple: данные содержат имена и адреса на разных языках, стемминг не нужен
+ALTER TABLE delivery ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', name), 'A') ||
+        setweight(to_tsvector('simple', email), 'A') ||
+        setweight(to_tsvector('simple', city), 'B') ||
+        setweight(to_tsvector('simple', address), 'C')
+    ) STORED;
+
+ALTER TABLE items ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', brand), 'A') ||
+        setweight(to_tsvector('simple', name), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_delivery_search_vector ON delivery USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_items_search_vector ON items USING GIN (search_vector);
+
+-- Выражения индексов должны совпадать с выражениями в запросе поиска
+CREATE INDEX IF NOT EXISTS idx_delivery_search_trgm ON delivery
+    USING GIN ((name || ' ' || city || ' ' || address || ' ' || email) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_items_search_trgm ON items
+    USING GIN ((name || ' ' || brand) gin_trgm_ops);
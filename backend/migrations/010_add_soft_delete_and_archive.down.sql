@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_orders_archive_order_uid;
+DROP TABLE IF EXISTS orders_archive;
+
+DROP INDEX IF EXISTS idx_orders_deleted_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS deleted_at;
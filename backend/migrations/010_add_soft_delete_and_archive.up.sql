@@ -0,0 +1,16 @@
+-- Мягкое удаление заказов: удаленные заказы скрываются от чтения до архивации
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_orders_deleted_at ON orders(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Архив заказов: снимок заказа со всеми связанными данными
+CREATE TABLE IF NOT EXISTS orders_archive (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR(255) NOT NULL,
+    snapshot JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    deleted_at TIMESTAMP,
+    archived_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_archive_order_uid ON orders_archive(order_uid);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_status_transitions_order_uid;
+DROP TABLE IF EXISTS status_transitions;
+
+DROP INDEX IF EXISTS idx_orders_status;
+ALTER TABLE payment DROP COLUMN IF EXISTS status;
+ALTER TABLE orders DROP COLUMN IF EXISTS status;
@@ -0,0 +1,18 @@
+-- Статусы заказа и платежа (значения model.OrderStatus и model.PaymentStatus)
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE payment ADD COLUMN IF NOT EXISTS status INTEGER NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
+
+-- Журнал переходов статусов
+CREATE TABLE IF NOT EXISTS status_transitions (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR(255) NOT NULL,
+    entity VARCHAR(16) NOT NULL,
+    from_status INTEGER NOT NULL,
+    to_status INTEGER NOT NULL,
+    request_id VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_status_transitions_order_uid ON status_transitions(order_uid, id);
@@ -0,0 +1,10 @@
+-- Откат не пройдет, если в базе уже есть суммы больше 2^31-1
+ALTER TABLE items
+    ALTER COLUMN total_price TYPE INTEGER,
+    ALTER COLUMN price TYPE INTEGER;
+
+ALTER TABLE payment
+    ALTER COLUMN custom_fee TYPE INTEGER,
+    ALTER COLUMN goods_total TYPE INTEGER,
+    ALTER COLUMN delivery_cost TYPE INTEGER,
+    ALTER COLUMN amount TYPE INTEGER;
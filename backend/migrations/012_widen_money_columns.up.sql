@@ -0,0 +1,10 @@
+-- Денежные суммы хранятся в минимальных единицах валюты (model.Amount, int64)
+ALTER TABLE payment
+    ALTER COLUMN amount TYPE BIGINT,
+    ALTER COLUMN delivery_cost TYPE BIGINT,
+    ALTER COLUMN goods_total TYPE BIGINT,
+    ALTER COLUMN custom_fee TYPE BIGINT;
+
+ALTER TABLE items
+    ALTER COLUMN price TYPE BIGINT,
+    ALTER COLUMN total_price TYPE BIGINT;
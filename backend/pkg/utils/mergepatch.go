@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MergePatch применяет JSON Merge Patch (RFC 7396) к документу target.
+// null в patch удаляет поле, объекты объединяются рекурсивно, остальные значения
+// (в том числе массивы) заменяются целиком
+func MergePatch(target, patch []byte) ([]byte, error) {
+	targetValue, err := decodeJSON(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target document: %w", err)
+	}
+	patchValue, err := decodeJSON(patch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+
+	return json.Marshal(mergeValue(targetValue, patchValue))
+}
+
+// decodeJSON разбирает JSON-документ, сохраняя числа как json.Number, чтобы большие
+// целые значения (суммы, идентификаторы) не теряли точность при преобразовании в float64
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("unexpected data after JSON document")
+	}
+
+	return value, nil
+}
+
+// mergeValue реализует алгоритм MergePatch из RFC 7396
+func mergeValue(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergeValue(targetObject[key], value)
+	}
+
+	return targetObject
+}
@@ -0,0 +1,37 @@
+package utils
+
+import "testing"
+
+func TestMergePatch(t *testing.T) {
+	for _, tc := range []struct {
+		name, target, patch, want string
+	}{
+		{
+			name:   "merges objects and removes null fields",
+			target: `{"a":1,"b":{"c":2,"d":3}}`,
+			patch:  `{"b":{"c":null,"e":4}}`,
+			want:   `{"a":1,"b":{"d":3,"e":4}}`,
+		},
+		{
+			name:   "keeps large integers exact",
+			target: `{"amount":9007199254740993,"payment_dt":1637907727}`,
+			patch:  `{"custom_fee":9223372036854775807}`,
+			want:   `{"amount":9007199254740993,"custom_fee":9223372036854775807,"payment_dt":1637907727}`,
+		},
+		{name: "replaces arrays", target: `{"items":[1,2]}`, patch: `{"items":[3]}`, want: `{"items":[3]}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tc.target), []byte(tc.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Fatalf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := MergePatch([]byte(`{}`), []byte(`{} {}`)); err == nil {
+		t.Fatal("expected error for trailing data in patch")
+	}
+}